@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// batchingExporter splits each export into requests of at most maxDataPoints
+// data points, so a large cluster's metrics don't produce payloads exceeding
+// the collector's request size limit. Zero disables splitting.
+type batchingExporter struct {
+	sdkmetric.Exporter
+	maxDataPoints int
+}
+
+func (e batchingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.maxDataPoints <= 0 {
+		return e.Exporter.Export(ctx, rm)
+	}
+
+	var errs []error
+	for _, batch := range splitResourceMetrics(rm, e.maxDataPoints) {
+		if err := e.Exporter.Export(ctx, batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// splitResourceMetrics splits rm into batches of at most max data points,
+// splitting the data points of a single metric across batches if needed.
+func splitResourceMetrics(rm *metricdata.ResourceMetrics, max int) []*metricdata.ResourceMetrics {
+	var batches []*metricdata.ResourceMetrics
+	var current *metricdata.ResourceMetrics
+	var size int
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, part := range splitMetric(m, max) {
+				n := dataPointCount(part)
+				if current == nil || size+n > max {
+					current = &metricdata.ResourceMetrics{Resource: rm.Resource}
+					batches = append(batches, current)
+					size = 0
+				}
+				if len(current.ScopeMetrics) == 0 || current.ScopeMetrics[len(current.ScopeMetrics)-1].Scope != sm.Scope {
+					current.ScopeMetrics = append(current.ScopeMetrics, metricdata.ScopeMetrics{Scope: sm.Scope})
+				}
+				last := &current.ScopeMetrics[len(current.ScopeMetrics)-1]
+				last.Metrics = append(last.Metrics, part)
+				size += n
+			}
+		}
+	}
+	return batches
+}
+
+// splitMetric splits m into metrics of at most max data points each.
+func splitMetric(m metricdata.Metrics, max int) []metricdata.Metrics {
+	var parts []metricdata.Metrics
+	add := func(data metricdata.Aggregation) {
+		part := m
+		part.Data = data
+		parts = append(parts, part)
+	}
+
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Gauge[int64]{DataPoints: dps})
+		}
+	case metricdata.Gauge[float64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Gauge[float64]{DataPoints: dps})
+		}
+	case metricdata.Sum[int64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Sum[int64]{DataPoints: dps, Temporality: data.Temporality, IsMonotonic: data.IsMonotonic})
+		}
+	case metricdata.Sum[float64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Sum[float64]{DataPoints: dps, Temporality: data.Temporality, IsMonotonic: data.IsMonotonic})
+		}
+	case metricdata.Histogram[int64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Histogram[int64]{DataPoints: dps, Temporality: data.Temporality})
+		}
+	case metricdata.Histogram[float64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.Histogram[float64]{DataPoints: dps, Temporality: data.Temporality})
+		}
+	case metricdata.ExponentialHistogram[int64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.ExponentialHistogram[int64]{DataPoints: dps, Temporality: data.Temporality})
+		}
+	case metricdata.ExponentialHistogram[float64]:
+		for _, dps := range chunk(data.DataPoints, max) {
+			add(metricdata.ExponentialHistogram[float64]{DataPoints: dps, Temporality: data.Temporality})
+		}
+	default:
+		parts = append(parts, m)
+	}
+	return parts
+}
+
+func dataPointCount(m metricdata.Metrics) int {
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		return len(data.DataPoints)
+	case metricdata.Gauge[float64]:
+		return len(data.DataPoints)
+	case metricdata.Sum[int64]:
+		return len(data.DataPoints)
+	case metricdata.Sum[float64]:
+		return len(data.DataPoints)
+	case metricdata.Histogram[int64]:
+		return len(data.DataPoints)
+	case metricdata.Histogram[float64]:
+		return len(data.DataPoints)
+	case metricdata.ExponentialHistogram[int64]:
+		return len(data.DataPoints)
+	case metricdata.ExponentialHistogram[float64]:
+		return len(data.DataPoints)
+	default:
+		return 1
+	}
+}
+
+func chunk[T any](s []T, size int) [][]T {
+	var chunks [][]T
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	return append(chunks, s)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// recordingExporter records the data point count of every export.
+type recordingExporter struct {
+	sdkmetric.Exporter
+	sizes []int
+}
+
+func (e *recordingExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	var n int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			n += dataPointCount(m)
+		}
+	}
+	e.sizes = append(e.sizes, n)
+	return nil
+}
+
+// sumMetric returns a counter named name with n data points.
+func sumMetric(name string, n int) metricdata.Metrics {
+	return metricdata.Metrics{
+		Name: name,
+		Data: metricdata.Sum[int64]{
+			DataPoints:  make([]metricdata.DataPoint[int64], n),
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+		},
+	}
+}
+
+func TestBatchingExporter(t *testing.T) {
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope:   instrumentation.Scope{Name: "pullmetrics"},
+				Metrics: []metricdata.Metrics{sumMetric("k8s.image.pulls", 5), sumMetric("k8s.image.pull.failures", 2)},
+			},
+			{
+				Scope:   instrumentation.Scope{Name: "informer"},
+				Metrics: []metricdata.Metrics{sumMetric("k8s.image.pull.informer.cache_size", 1)},
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		maxDataPoints int
+		wantSizes     []int
+	}{
+		{name: "disabled", maxDataPoints: 0, wantSizes: []int{8}},
+		{name: "under the limit", maxDataPoints: 10, wantSizes: []int{8}},
+		{name: "at the limit", maxDataPoints: 8, wantSizes: []int{8}},
+		{name: "splits a metric", maxDataPoints: 3, wantSizes: []int{3, 2, 3}},
+		{name: "one per request", maxDataPoints: 1, wantSizes: []int{1, 1, 1, 1, 1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingExporter{}
+			if err := (batchingExporter{recorder, tt.maxDataPoints}).Export(context.Background(), rm); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(recorder.sizes, tt.wantSizes) {
+				t.Errorf("exported batches of %v data points, want %v", recorder.sizes, tt.wantSizes)
+			}
+		})
+	}
+}
+
+func TestSplitResourceMetricsKeepsScopes(t *testing.T) {
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "a"}, Metrics: []metricdata.Metrics{sumMetric("one", 1)}},
+			{Scope: instrumentation.Scope{Name: "b"}, Metrics: []metricdata.Metrics{sumMetric("two", 1)}},
+		},
+	}
+	batches := splitResourceMetrics(rm, 2)
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+	var scopes []string
+	for _, sm := range batches[0].ScopeMetrics {
+		scopes = append(scopes, sm.Scope.Name)
+	}
+	if len(scopes) != 2 || scopes[0] != "a" || scopes[1] != "b" {
+		t.Errorf("batch scopes = %v, want [a b]", scopes)
+	}
+}
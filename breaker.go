@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// exportBreaker opens after -breaker-threshold consecutive failed exports.
+// While it's open the backend is assumed down, so object lookups are skipped
+// until an export succeeds again. That only saves work with delta
+// temporality, whose failed exports drop their measurements: with cumulative
+// temporality the SDK delivers them once the backend recovers, recorded
+// without the attributes lookups derive, so it's disabled by default.
+var exportBreaker = &circuitBreaker{}
+
+type circuitBreaker struct {
+	// threshold of consecutive failures that opens the breaker, 0 disables it
+	threshold int64
+	failures  atomic.Int64
+}
+
+// isOpen reports whether enough consecutive exports failed to open the breaker.
+func (b *circuitBreaker) isOpen() bool {
+	return b.threshold > 0 && b.failures.Load() >= b.threshold
+}
+
+func (b *circuitBreaker) observe(err error) {
+	if err == nil {
+		if b.isOpen() {
+			log.Println("Export succeeded, closing circuit breaker")
+		}
+		b.failures.Store(0)
+		return
+	}
+	if b.failures.Add(1) == b.threshold {
+		log.Println("Opening circuit breaker after", b.threshold, "consecutive failed exports:", err)
+	}
+}
+
+// registerBreakerGauge reports 1 while the breaker is open and 0 otherwise.
+func registerBreakerGauge(meter metric.Meter) error {
+	_, err := meter.Int64ObservableGauge(
+		"k8s.image.pull.breaker_open",
+		metric.WithDescription("Whether processing is degraded because exports keep failing (1) or not (0)."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			var open int64
+			if exportBreaker.isOpen() {
+				open = 1
+			}
+			o.Observe(open)
+			return nil
+		}),
+	)
+	return err
+}
+
+// breakerExporter feeds the outcome of every export into exportBreaker.
+type breakerExporter struct {
+	sdkmetric.Exporter
+}
+
+func (e breakerExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	exportBreaker.observe(err)
+	return err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// scriptedExporter fails the exports whose outcome in script is false.
+type scriptedExporter struct {
+	sdkmetric.Exporter
+	script []bool
+	calls  int
+}
+
+func (e *scriptedExporter) Export(context.Context, *metricdata.ResourceMetrics) error {
+	ok := e.script[e.calls]
+	e.calls++
+	if !ok {
+		return errors.New("collector unavailable")
+	}
+	return nil
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		// outcomes of consecutive exports
+		script []bool
+		// whether the breaker is open after each export
+		wantOpen []bool
+	}{
+		{
+			name:      "opens at threshold and closes on success",
+			threshold: 3,
+			script:    []bool{false, false, false, false, true, false},
+			wantOpen:  []bool{false, false, true, true, false, false},
+		},
+		{
+			name:      "success resets the count",
+			threshold: 3,
+			script:    []bool{false, false, true, false, false},
+			wantOpen:  []bool{false, false, false, false, false},
+		},
+		{
+			name:      "disabled",
+			threshold: 0,
+			script:    []bool{false, false, false, false},
+			wantOpen:  []bool{false, false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := exportBreaker
+			t.Cleanup(func() { exportBreaker = previous })
+			exportBreaker = &circuitBreaker{threshold: tt.threshold}
+
+			exporter := breakerExporter{&scriptedExporter{script: tt.script}}
+			for i, ok := range tt.script {
+				err := exporter.Export(context.Background(), &metricdata.ResourceMetrics{})
+				if (err == nil) != ok {
+					t.Fatalf("export %d returned %v, want success %v", i, err, ok)
+				}
+				if open := exportBreaker.isOpen(); open != tt.wantOpen[i] {
+					t.Errorf("after export %d open = %v, want %v", i, open, tt.wantOpen[i])
+				}
+			}
+		})
+	}
+}
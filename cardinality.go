@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// cardinalityLimitEnv is the experimental SDK setting capping the distinct
+// attribute sets aggregated per instrument. The SDK has no public option for
+// it yet.
+const cardinalityLimitEnv = "OTEL_GO_X_CARDINALITY_LIMIT"
+
+// setCardinalityLimit caps each instrument at limit series: once limit-1
+// distinct attribute sets were recorded, further ones collapse into a single
+// series with the otel.metric.overflow=true attribute. The SDK reads the
+// limit when instruments are created, so it must be set before. A limit of 0
+// leaves OTEL_GO_X_CARDINALITY_LIMIT as configured in the environment.
+func setCardinalityLimit(limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	return os.Setenv(cardinalityLimitEnv, strconv.Itoa(limit))
+}
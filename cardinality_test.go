@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSetCardinalityLimit(t *testing.T) {
+	t.Setenv(cardinalityLimitEnv, "")
+	if err := setCardinalityLimit(3); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	counter, err := provider.Meter("test").Int64Counter("k8s.image.pulls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		counter.Add(context.Background(), 1, metric.WithAttributes(attribute.String("exported.namespace", "ns-"+strconv.Itoa(i))))
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	points := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[int64]).DataPoints
+	if len(points) != 3 {
+		t.Fatalf("got %d series, want 3", len(points))
+	}
+	var overflow int64
+	for _, p := range points {
+		if v, ok := p.Attributes.Value("otel.metric.overflow"); ok && v.AsBool() {
+			overflow += p.Value
+		}
+	}
+	// the first 2 namespaces keep their series, the other 3 overflow
+	if overflow != 3 {
+		t.Errorf("otel.metric.overflow series = %d, want 3", overflow)
+	}
+}
+
+func TestSetCardinalityLimitZero(t *testing.T) {
+	t.Setenv(cardinalityLimitEnv, "100")
+	if err := setCardinalityLimit(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv(cardinalityLimitEnv); got != "100" {
+		t.Errorf("%s = %q, want the environment's 100", cardinalityLimitEnv, got)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// collectorAddress returns the host:port OTLP metrics are sent to: the
+// proxy if set, otherwise the host of endpoint, falling back to the
+// OTEL_EXPORTER_OTLP_* environment variables and the exporter's default of
+// localhost:4318.
+func collectorAddress(endpoint string, proxy *url.URL) (string, error) {
+	if proxy != nil {
+		return hostPort(proxy), nil
+	}
+	if endpoint == "" {
+		endpoint = signalEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"), os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/v1/metrics")
+	}
+	if endpoint == "" {
+		return "localhost:4318", nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP metrics endpoint %q", endpoint)
+	}
+	return hostPort(u), nil
+}
+
+// hostPort returns the host and port of u, defaulting the port by scheme.
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// waitForCollector blocks until a TCP connection to address succeeds, e.g.
+// while the collector is still starting during cluster bootstrap, so the
+// first exports don't fail. Attempts back off exponentially from 1s to 30s,
+// and it fails once timeout elapsed.
+func waitForCollector(ctx context.Context, address string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	backoff := time.Second
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			conn.Close()
+			log.Println("OTLP collector at", address, "is reachable")
+			return nil
+		}
+		log.Println("Waiting for OTLP collector at", address+":", err, "- retrying in", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("OTLP collector at %s not reachable within %v: %w", address, timeout, err)
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// freeAddress returns a local address nothing listens on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+	return address
+}
+
+func TestWaitForCollectorDelayedListener(t *testing.T) {
+	address := freeAddress(t)
+	listening := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Error(err)
+			close(listening)
+			return
+		}
+		listening <- l
+	}()
+	t.Cleanup(func() {
+		if l, ok := <-listening; ok {
+			l.Close()
+		}
+	})
+
+	start := time.Now()
+	if err := waitForCollector(context.Background(), address, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the first attempt fails, the one after the 1s backoff succeeds
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("waitForCollector returned after %v, before the listener started", elapsed)
+	}
+}
+
+func TestWaitForCollectorTimeout(t *testing.T) {
+	address := freeAddress(t)
+	start := time.Now()
+	err := waitForCollector(context.Background(), address, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "not reachable within 200ms") {
+		t.Fatalf("waitForCollector() = %v, want a not reachable error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("waitForCollector took %v, want about the 200ms timeout", elapsed)
+	}
+}
+
+func TestCollectorAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		proxy    string
+		env      string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", want: "localhost:4318"},
+		{name: "endpoint", endpoint: "https://otel.example.com:4318/v1/metrics", want: "otel.example.com:4318"},
+		{name: "default https port", endpoint: "https://otel.example.com/v1/metrics", want: "otel.example.com:443"},
+		{name: "default http port", endpoint: "http://otel.example.com/v1/metrics", want: "otel.example.com:80"},
+		{name: "environment", env: "http://collector:4318", want: "collector:4318"},
+		{name: "proxy", endpoint: "https://otel.example.com/v1/metrics", proxy: "socks5://proxy.internal", want: "proxy.internal:1080"},
+		{name: "invalid", endpoint: "otel.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.env)
+			var proxy *url.URL
+			if tt.proxy != "" {
+				var err error
+				if proxy, err = url.Parse(tt.proxy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := collectorAddress(tt.endpoint, proxy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("collectorAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("collectorAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
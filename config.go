@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// applyConfigFile sets the flags of fs from the YAML or JSON file at path,
+// which maps flag names to values, e.g.
+//
+//	exporter: otlp,prometheus
+//	duration-buckets: [15000, 30000, 60000]
+//	otlp-header:
+//	  api-key: secret
+//	registry-denylist: [registry.k8s.io]
+//
+// Flags given on the command line take precedence over the file. Lists are
+// joined with commas, except for repeatable flags, which are set once per
+// element, and maps are set as key=value pairs. Unknown keys are rejected.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	onCommandLine := setFlags(fs)
+
+	// sorted for deterministic errors
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown key %q", name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		args, err := configValues(values[name], repeatable(f))
+		if err != nil {
+			return fmt.Errorf("key %q: %w", name, err)
+		}
+		for _, arg := range args {
+			if err := fs.Set(name, arg); err != nil {
+				return fmt.Errorf("key %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setFlags returns the names of the flags of fs that have been set.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// repeatable reports whether f accumulates the values it's set to rather
+// than replacing them.
+func repeatable(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case headersFlag, *messageTemplatesFlag:
+		return true
+	}
+	return false
+}
+
+// configValues converts the value of a config file key into the arguments
+// its flag is set to.
+func configValues(value any, repeatable bool) ([]string, error) {
+	switch v := value.(type) {
+	case []any:
+		args := make([]string, len(v))
+		for i, elem := range v {
+			arg, err := configScalar(elem)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = arg
+		}
+		if repeatable {
+			return args, nil
+		}
+		return []string{strings.Join(args, ",")}, nil
+	case map[string]any:
+		if !repeatable {
+			return nil, fmt.Errorf("expected a single value or a list, got a map")
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		args := make([]string, len(keys))
+		for i, key := range keys {
+			arg, err := configScalar(v[key])
+			if err != nil {
+				return nil, err
+			}
+			args[i] = key + "=" + arg
+		}
+		return args, nil
+	default:
+		arg, err := configScalar(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{arg}, nil
+	}
+}
+
+func configScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newConfigFlagSet returns a FlagSet with flags of each kind the config file
+// sets, parsed from args.
+func newConfigFlagSet(t *testing.T, args ...string) (*flag.FlagSet, headersFlag, *messageTemplatesFlag) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.String("exporter", "otlp", "")
+	fs.String("duration-buckets", "", "")
+	fs.String("registry-denylist", "", "")
+	fs.Float64("sample-rate", 1, "")
+	fs.Bool("histogram-min-max", false, "")
+	fs.Duration("max-event-age", 0, "")
+	headers := headersFlag{}
+	fs.Var(headers, "otlp-header", "")
+	templates := &messageTemplatesFlag{}
+	fs.Var(templates, "message-templates", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs, headers, templates
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `exporter: otlp,prometheus
+duration-buckets: [15000, 30000, 60000]
+registry-denylist: [registry.k8s.io, quay.io]
+sample-rate: 0.25
+histogram-min-max: true
+max-event-age: 1h
+otlp-header:
+  x-team: infra
+  api-key: secret
+message-templates:
+- 'cri-o=^Pulled image "(?P<image>[^"]+)" after (?P<pull>\S+)$'
+`)
+	fs, headers, templates := newConfigFlagSet(t, "-sample-rate=1", "-exporter=prometheus")
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		// given on the command line
+		"exporter":    "prometheus",
+		"sample-rate": "1",
+		// from the file
+		"duration-buckets":  "15000,30000,60000",
+		"registry-denylist": "registry.k8s.io,quay.io",
+		"histogram-min-max": "true",
+		"max-event-age":     time.Hour.String(),
+	}
+	for name, value := range want {
+		if got := fs.Lookup(name).Value.String(); got != value {
+			t.Errorf("-%s = %q, want %q", name, got, value)
+		}
+	}
+	if headers["x-team"] != "infra" || headers["api-key"] != "secret" || len(headers) != 2 {
+		t.Errorf("-otlp-header = %v, want x-team and api-key", map[string]string(headers))
+	}
+	if len(*templates) != 1 || (*templates)[0].Name != "cri-o" {
+		t.Errorf("-message-templates = %v, want cri-o", *templates)
+	}
+}
+
+func TestApplyConfigFileRepeatableFlagsOnCommandLine(t *testing.T) {
+	path := writeConfigFile(t, "otlp-header:\n  api-key: file\n")
+	fs, headers, _ := newConfigFlagSet(t, "-otlp-header=api-key=flag")
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if headers["api-key"] != "flag" {
+		t.Errorf("api-key header = %q, want the command line's", headers["api-key"])
+	}
+}
+
+func TestApplyConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", content: "exporters: otlp\n", wantErr: `unknown key "exporters"`},
+		{name: "config itself", content: "config: other.yaml\n", wantErr: `unknown key "config"`},
+		{name: "invalid value", content: "sample-rate: often\n", wantErr: `key "sample-rate"`},
+		{name: "map for a single value", content: "exporter:\n  otlp: true\n", wantErr: "got a map"},
+		{name: "invalid YAML", content: "exporter: [otlp\n", wantErr: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _, _ := newConfigFlagSet(t)
+			err := applyConfigFile(fs, writeConfigFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyConfigFile() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	fs, _, _ := newConfigFlagSet(t)
+	if err := applyConfigFile(fs, filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("applyConfigFile of a missing file succeeded, want an error")
+	}
+}
+
+func TestApplyConfigFileJSON(t *testing.T) {
+	path := writeConfigFile(t, `{"exporter": "otlp,prometheus", "duration-buckets": [15000, 30000], "otlp-header": {"api-key": "secret"}}`)
+	fs, headers, _ := newConfigFlagSet(t)
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Lookup("exporter").Value.String(); got != "otlp,prometheus" {
+		t.Errorf("-exporter = %q, want otlp,prometheus", got)
+	}
+	if got := fs.Lookup("duration-buckets").Value.String(); got != "15000,30000" {
+		t.Errorf("-duration-buckets = %q, want 15000,30000", got)
+	}
+	if headers["api-key"] != "secret" {
+		t.Errorf("-otlp-header = %v, want api-key", map[string]string(headers))
+	}
+}
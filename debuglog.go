@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// debugMeter wraps the synchronous instruments of a meter to log every
+// measurement at debug level before it's aggregated, so -debug-log-records
+// shows exactly what the handler records, regardless of the exporters.
+type debugMeter struct {
+	metric.Meter
+}
+
+func (m debugMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	c, err := m.Meter.Int64Counter(name, opts...)
+	return debugInt64Counter{c, name}, err
+}
+
+func (m debugMeter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	c, err := m.Meter.Int64UpDownCounter(name, opts...)
+	return debugInt64UpDownCounter{c, name}, err
+}
+
+func (m debugMeter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	h, err := m.Meter.Int64Histogram(name, opts...)
+	return debugInt64Histogram{h, name}, err
+}
+
+func (m debugMeter) Int64Gauge(name string, opts ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	g, err := m.Meter.Int64Gauge(name, opts...)
+	return debugInt64Gauge{g, name}, err
+}
+
+func (m debugMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	h, err := m.Meter.Float64Histogram(name, opts...)
+	return debugFloat64Histogram{h, name}, err
+}
+
+type debugInt64Counter struct {
+	metric.Int64Counter
+	name string
+}
+
+func (c debugInt64Counter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	logMeasurement(ctx, c.name, incr, metric.NewAddConfig(opts).Attributes())
+	c.Int64Counter.Add(ctx, incr, opts...)
+}
+
+type debugInt64UpDownCounter struct {
+	metric.Int64UpDownCounter
+	name string
+}
+
+func (c debugInt64UpDownCounter) Add(ctx context.Context, incr int64, opts ...metric.AddOption) {
+	logMeasurement(ctx, c.name, incr, metric.NewAddConfig(opts).Attributes())
+	c.Int64UpDownCounter.Add(ctx, incr, opts...)
+}
+
+type debugInt64Histogram struct {
+	metric.Int64Histogram
+	name string
+}
+
+func (h debugInt64Histogram) Record(ctx context.Context, value int64, opts ...metric.RecordOption) {
+	logMeasurement(ctx, h.name, value, metric.NewRecordConfig(opts).Attributes())
+	h.Int64Histogram.Record(ctx, value, opts...)
+}
+
+type debugInt64Gauge struct {
+	metric.Int64Gauge
+	name string
+}
+
+func (g debugInt64Gauge) Record(ctx context.Context, value int64, opts ...metric.RecordOption) {
+	logMeasurement(ctx, g.name, value, metric.NewRecordConfig(opts).Attributes())
+	g.Int64Gauge.Record(ctx, value, opts...)
+}
+
+type debugFloat64Histogram struct {
+	metric.Float64Histogram
+	name string
+}
+
+func (h debugFloat64Histogram) Record(ctx context.Context, value float64, opts ...metric.RecordOption) {
+	logMeasurement(ctx, h.name, value, metric.NewRecordConfig(opts).Attributes())
+	h.Float64Histogram.Record(ctx, value, opts...)
+}
+
+func logMeasurement(ctx context.Context, instrument string, value any, attributes attribute.Set) {
+	attrs := make([]any, 0, attributes.Len())
+	for _, kv := range attributes.ToSlice() {
+		attrs = append(attrs, slog.Any(string(kv.Key), kv.Value.AsInterface()))
+	}
+	slog.DebugContext(ctx, "Recorded measurement", "instrument", instrument, "value", value, slog.Group("attributes", attrs...))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// captureLogs sends the default logger's records at level and above to the
+// returned buffer as JSON for the duration of the test.
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// collectMetricNames returns the names of the metrics collected by reader.
+func collectMetricNames(t *testing.T, reader *sdkmetric.ManualReader) []string {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+func TestDebugMeter(t *testing.T) {
+	attributes := metric.WithAttributes(attribute.String("exported.namespace", "default"), attribute.Bool("exported.image.retried", true))
+	tests := []struct {
+		name   string
+		record func(t *testing.T, m metric.Meter)
+		value  any
+	}{
+		{
+			name: "k8s.image.pulls",
+			record: func(t *testing.T, m metric.Meter) {
+				c, err := m.Int64Counter("k8s.image.pulls")
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Add(context.Background(), 2, attributes)
+			},
+			value: 2.0,
+		},
+		{
+			name: "k8s.image.pull.in_flight",
+			record: func(t *testing.T, m metric.Meter) {
+				c, err := m.Int64UpDownCounter("k8s.image.pull.in_flight")
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Add(context.Background(), -1, attributes)
+			},
+			value: -1.0,
+		},
+		{
+			name: "k8s.image.pull.duration",
+			record: func(t *testing.T, m metric.Meter) {
+				h, err := m.Int64Histogram("k8s.image.pull.duration")
+				if err != nil {
+					t.Fatal(err)
+				}
+				h.Record(context.Background(), 1500, attributes)
+			},
+			value: 1500.0,
+		},
+		{
+			name: "k8s.image.size",
+			record: func(t *testing.T, m metric.Meter) {
+				g, err := m.Int64Gauge("k8s.image.size")
+				if err != nil {
+					t.Fatal(err)
+				}
+				g.Record(context.Background(), 1000, attributes)
+			},
+			value: 1000.0,
+		},
+		{
+			name: "k8s.image.pull.wait_ratio",
+			record: func(t *testing.T, m metric.Meter) {
+				h, err := m.Float64Histogram("k8s.image.pull.wait_ratio")
+				if err != nil {
+					t.Fatal(err)
+				}
+				h.Record(context.Background(), 0.25, attributes)
+			},
+			value: 0.25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t, slog.LevelDebug)
+			reader := sdkmetric.NewManualReader()
+			meter := debugMeter{sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")}
+			tt.record(t, meter)
+
+			var record struct {
+				Level      string         `json:"level"`
+				Msg        string         `json:"msg"`
+				Instrument string         `json:"instrument"`
+				Value      any            `json:"value"`
+				Attributes map[string]any `json:"attributes"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+				t.Fatalf("decoding %q: %v", logs.String(), err)
+			}
+			if record.Level != "DEBUG" || record.Msg != "Recorded measurement" || record.Instrument != tt.name || record.Value != tt.value {
+				t.Errorf("logged %s, want a debug record of %s = %v", logs.String(), tt.name, tt.value)
+			}
+			if record.Attributes["exported.namespace"] != "default" || record.Attributes["exported.image.retried"] != true {
+				t.Errorf("logged attributes %v, want exported.namespace and exported.image.retried", record.Attributes)
+			}
+
+			// the measurement is still recorded
+			if got := collectMetricNames(t, reader); len(got) != 1 || got[0] != tt.name {
+				t.Errorf("collected %v, want %s", got, tt.name)
+			}
+		})
+	}
+}
+
+func TestDebugMeterLogsNothingAboveDebug(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+	c, _ := debugMeter{sdkmetric.NewMeterProvider().Meter("test")}.Int64Counter("k8s.image.pulls")
+	c.Add(context.Background(), 1)
+	if logs.Len() != 0 {
+		t.Errorf("logged %q at info level, want nothing", logs.String())
+	}
+}
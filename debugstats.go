@@ -0,0 +1,63 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+)
+
+// debugStats exposes internal counters for quick troubleshooting with curl,
+// without needing a metrics backend. They are published via expvar and
+// served read-only on /debug/stats.
+var debugStats = expvar.NewMap("k8s_image_pull_metrics")
+
+// publishStats adds the counters of handlers, summed over all of them, to
+// the stats.
+func publishStats(handlers ...*pullmetrics.Handler) {
+	debugStats.Set("events_seen", expvar.Func(func() any {
+		return totalStats(handlers).EventsSeen
+	}))
+	debugStats.Set("parse_failures", expvar.Func(func() any {
+		return totalStats(handlers).ParseFailures
+	}))
+	debugStats.Set("last_processed", expvar.Func(func() any {
+		if t := totalStats(handlers).LastProcessed; !t.IsZero() {
+			return t.UTC().Format(time.RFC3339)
+		}
+		return ""
+	}))
+	debugStats.Set("cache_sizes", expvar.Func(func() any {
+		return totalStats(handlers).CacheSizes
+	}))
+}
+
+// totalStats sums the counters and cache sizes of handlers and returns the
+// latest time any of them processed a pull.
+func totalStats(handlers []*pullmetrics.Handler) pullmetrics.Stats {
+	total := pullmetrics.Stats{CacheSizes: map[string]int{}}
+	for _, handler := range handlers {
+		s := handler.Stats()
+		total.EventsSeen += s.EventsSeen
+		total.ParseFailures += s.ParseFailures
+		if s.LastProcessed.After(total.LastProcessed) {
+			total.LastProcessed = s.LastProcessed
+		}
+		for name, size := range s.CacheSizes {
+			total.CacheSizes[name] += size
+		}
+	}
+	return total
+}
+
+// serveDebugStats writes the stats as JSON.
+func serveDebugStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(debugStats.String()))
+}
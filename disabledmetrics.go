@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// disablingMeter hands out no-op instruments for the instrument names in
+// disabled, so -disabled-metrics instruments are never created on the
+// underlying meter and recording to them costs nothing.
+type disablingMeter struct {
+	metric.Meter
+	disabled map[string]bool
+	// requested records the disabled names asked for, so names that
+	// match no instrument can be reported by unknownDisabled.
+	requested *requestedNames
+}
+
+type requestedNames struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// disableInstruments returns meter without the named instruments.
+func disableInstruments(meter metric.Meter, names []string) metric.Meter {
+	if len(names) == 0 {
+		return meter
+	}
+	disabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		disabled[name] = true
+	}
+	return disablingMeter{Meter: meter, disabled: disabled, requested: &requestedNames{names: map[string]bool{}}}
+}
+
+// isDisabled reports whether name is disabled and records that an
+// instrument of that name was requested.
+func (m disablingMeter) isDisabled(name string) bool {
+	if !m.disabled[name] {
+		return false
+	}
+	m.requested.mu.Lock()
+	m.requested.names[name] = true
+	m.requested.mu.Unlock()
+	return true
+}
+
+// unknownDisabled returns the sorted -disabled-metrics names no instrument
+// has been requested for so far, most likely typos.
+func unknownDisabled(meter metric.Meter) []string {
+	m, ok := meter.(disablingMeter)
+	if !ok {
+		return nil
+	}
+	m.requested.mu.Lock()
+	defer m.requested.mu.Unlock()
+	var unknown []string
+	for name := range m.disabled {
+		if !m.requested.names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+func (m disablingMeter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	if m.isDisabled(name) {
+		return noop.Int64Counter{}, nil
+	}
+	return m.Meter.Int64Counter(name, opts...)
+}
+
+func (m disablingMeter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	if m.isDisabled(name) {
+		return noop.Int64UpDownCounter{}, nil
+	}
+	return m.Meter.Int64UpDownCounter(name, opts...)
+}
+
+func (m disablingMeter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	if m.isDisabled(name) {
+		return noop.Int64Histogram{}, nil
+	}
+	return m.Meter.Int64Histogram(name, opts...)
+}
+
+func (m disablingMeter) Int64Gauge(name string, opts ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	if m.isDisabled(name) {
+		return noop.Int64Gauge{}, nil
+	}
+	return m.Meter.Int64Gauge(name, opts...)
+}
+
+func (m disablingMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	if m.isDisabled(name) {
+		return noop.Float64Histogram{}, nil
+	}
+	return m.Meter.Float64Histogram(name, opts...)
+}
+
+func (m disablingMeter) Int64ObservableGauge(name string, opts ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	if m.isDisabled(name) {
+		return noop.Int64ObservableGauge{}, nil
+	}
+	return m.Meter.Int64ObservableGauge(name, opts...)
+}
+
+// RegisterCallback registers f for the enabled instruments only, as the SDK
+// rejects instruments it didn't create, and drops its observations of
+// disabled ones.
+func (m disablingMeter) RegisterCallback(f metric.Callback, instruments ...metric.Observable) (metric.Registration, error) {
+	var enabled []metric.Observable
+	for _, inst := range instruments {
+		if _, ok := inst.(noop.Int64ObservableGauge); !ok {
+			enabled = append(enabled, inst)
+		}
+	}
+	if len(enabled) == 0 {
+		return noop.Registration{}, nil
+	}
+	return m.Meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		return f(ctx, enabledObserver{o})
+	}, enabled...)
+}
+
+// enabledObserver drops observations of disabled instruments.
+type enabledObserver struct {
+	metric.Observer
+}
+
+func (o enabledObserver) ObserveInt64(inst metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	if _, ok := inst.(noop.Int64ObservableGauge); ok {
+		return
+	}
+	o.Observer.ObserveInt64(inst, value, opts...)
+}
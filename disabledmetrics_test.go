@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestDisableInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter := disableInstruments(provider.Meter("test"), []string{
+		"disabled.counter", "disabled.histogram", "disabled.gauge", "disabled.observable", "typo",
+	})
+	ctx := context.Background()
+
+	for _, name := range []string{"enabled.counter", "disabled.counter"} {
+		c, err := meter.Int64Counter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Add(ctx, 1)
+	}
+	for _, name := range []string{"enabled.histogram", "disabled.histogram"} {
+		h, err := meter.Float64Histogram(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Record(ctx, 1)
+	}
+	for _, name := range []string{"enabled.gauge", "disabled.gauge"} {
+		g, err := meter.Int64Gauge(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Record(ctx, 1)
+	}
+	enabled, err := meter.Int64ObservableGauge("enabled.observable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := meter.Int64ObservableGauge("disabled.observable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(enabled, 1)
+		o.ObserveInt64(disabled, 1)
+		return nil
+	}, enabled, disabled); err != nil {
+		t.Fatal(err)
+	}
+
+	names := collectMetricNames(t, reader)
+	slices.Sort(names)
+	want := []string{"enabled.counter", "enabled.gauge", "enabled.histogram", "enabled.observable"}
+	if !slices.Equal(names, want) {
+		t.Errorf("collected %v, want %v", names, want)
+	}
+	if got := unknownDisabled(meter); !slices.Equal(got, []string{"typo"}) {
+		t.Errorf("unknownDisabled() = %v, want [typo]", got)
+	}
+}
+
+func TestDisableInstrumentsNone(t *testing.T) {
+	meter := sdkmetric.NewMeterProvider().Meter("test")
+	if got := disableInstruments(meter, nil); got != meter {
+		t.Errorf("disableInstruments(meter, nil) = %T, want meter unchanged", got)
+	}
+	if got := unknownDisabled(meter); got != nil {
+		t.Errorf("unknownDisabled() = %v, want nil", got)
+	}
+}
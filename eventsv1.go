@@ -0,0 +1,59 @@
+package main
+
+import (
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+)
+
+// toCoreEvent returns obj as a core/v1 Event. Events from the
+// events.k8s.io/v1 API are mapped onto the core/v1 fields the handlers use,
+// so both APIs share the same processing.
+func toCoreEvent(obj interface{}) (*v1.Event, bool) {
+	switch e := obj.(type) {
+	case *v1.Event:
+		return e, true
+	case *eventsv1.Event:
+		return fromEventsV1(e), true
+	default:
+		return nil, false
+	}
+}
+
+// fromEventsV1 maps an events.k8s.io/v1 Event onto a core/v1 Event: Note
+// becomes Message, Regarding becomes InvolvedObject, and the timestamps and
+// count come from the event series when the deprecated fields aren't set.
+func fromEventsV1(e *eventsv1.Event) *v1.Event {
+	event := &v1.Event{
+		ObjectMeta:          e.ObjectMeta,
+		InvolvedObject:      e.Regarding,
+		Reason:              e.Reason,
+		Message:             e.Note,
+		Source:              e.DeprecatedSource,
+		FirstTimestamp:      e.DeprecatedFirstTimestamp,
+		LastTimestamp:       e.DeprecatedLastTimestamp,
+		Count:               e.DeprecatedCount,
+		Type:                e.Type,
+		EventTime:           e.EventTime,
+		Action:              e.Action,
+		Related:             e.Related,
+		ReportingController: e.ReportingController,
+		ReportingInstance:   e.ReportingInstance,
+	}
+
+	if e.Series != nil {
+		event.Count = e.Series.Count
+		if event.LastTimestamp.IsZero() {
+			event.LastTimestamp.Time = e.Series.LastObservedTime.Time
+		}
+	}
+	if event.Count == 0 {
+		event.Count = 1
+	}
+	if event.FirstTimestamp.IsZero() {
+		event.FirstTimestamp.Time = e.EventTime.Time
+	}
+	if event.LastTimestamp.IsZero() {
+		event.LastTimestamp.Time = e.EventTime.Time
+	}
+	return event
+}
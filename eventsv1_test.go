@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFromEventsV1(t *testing.T) {
+	eventTime := time.Date(2026, 10, 15, 6, 0, 0, 0, time.UTC)
+	first := metav1.NewTime(eventTime.Add(-time.Minute))
+	last := metav1.NewTime(eventTime.Add(time.Minute))
+	regarding := v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1", FieldPath: "spec.containers{web}"}
+
+	tests := []struct {
+		name      string
+		event     eventsv1.Event
+		wantCount int32
+		wantFirst time.Time
+		wantLast  time.Time
+	}{
+		{
+			name:      "new fields only",
+			event:     eventsv1.Event{EventTime: metav1.NewMicroTime(eventTime)},
+			wantCount: 1,
+			wantFirst: eventTime,
+			wantLast:  eventTime,
+		},
+		{
+			name: "series",
+			event: eventsv1.Event{
+				EventTime: metav1.NewMicroTime(eventTime),
+				Series:    &eventsv1.EventSeries{Count: 4, LastObservedTime: metav1.NewMicroTime(last.Time)},
+			},
+			wantCount: 4,
+			wantFirst: eventTime,
+			wantLast:  last.Time,
+		},
+		{
+			name: "deprecated fields",
+			event: eventsv1.Event{
+				EventTime:                metav1.NewMicroTime(eventTime),
+				DeprecatedFirstTimestamp: first,
+				DeprecatedLastTimestamp:  last,
+				DeprecatedCount:          3,
+			},
+			wantCount: 3,
+			wantFirst: first.Time,
+			wantLast:  last.Time,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.Regarding = regarding
+			tt.event.Reason = "Pulled"
+			tt.event.Note = `Successfully pulled image "nginx:1.27" in 1.5s`
+			tt.event.ReportingController = "kubelet"
+			tt.event.ReportingInstance = "node-1"
+
+			event, ok := toCoreEvent(&tt.event)
+			if !ok {
+				t.Fatal("toCoreEvent didn't convert the events.k8s.io/v1 Event")
+			}
+			if event.InvolvedObject != regarding || event.Reason != "Pulled" || event.Message != tt.event.Note {
+				t.Errorf("event = %+v %q %q, want the Regarding, Reason and Note of %+v", event.InvolvedObject, event.Reason, event.Message, tt.event)
+			}
+			if event.ReportingController != "kubelet" || event.ReportingInstance != "node-1" {
+				t.Errorf("reporting = %q %q, want kubelet node-1", event.ReportingController, event.ReportingInstance)
+			}
+			if event.Count != tt.wantCount {
+				t.Errorf("Count = %d, want %d", event.Count, tt.wantCount)
+			}
+			if !event.FirstTimestamp.Time.Equal(tt.wantFirst) || !event.LastTimestamp.Time.Equal(tt.wantLast) {
+				t.Errorf("timestamps = %v, %v, want %v, %v", event.FirstTimestamp, event.LastTimestamp, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestToCoreEvent(t *testing.T) {
+	core := &v1.Event{Reason: "Pulled"}
+	if event, ok := toCoreEvent(core); !ok || event != core {
+		t.Errorf("toCoreEvent(core/v1 Event) = %v, %v, want the event itself", event, ok)
+	}
+	if _, ok := toCoreEvent(&v1.Pod{}); ok {
+		t.Error("toCoreEvent(Pod) succeeded, want false")
+	}
+}
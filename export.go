@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// manualExport pushes metrics only when asked to, for short-lived jobs and CI
+// runs where the periodic reader's interval would never elapse.
+type manualExport struct {
+	mu       sync.Mutex
+	reader   *sdkmetric.ManualReader
+	exporter sdkmetric.Exporter
+}
+
+func newManualExport(exporter sdkmetric.Exporter) *manualExport {
+	return &manualExport{
+		reader: sdkmetric.NewManualReader(
+			sdkmetric.WithTemporalitySelector(exporter.Temporality),
+			sdkmetric.WithAggregationSelector(exporter.Aggregation),
+		),
+		exporter: exporter,
+	}
+}
+
+// export collects the current metrics and pushes them through the exporter.
+func (m *manualExport) export(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rm metricdata.ResourceMetrics
+	if err := m.reader.Collect(ctx, &rm); err != nil {
+		return err
+	}
+	return m.exporter.Export(ctx, &rm)
+}
+
+// shutdown pushes whatever was recorded since the last export and shuts the
+// exporter down. The reader itself is shut down by the meter provider.
+func (m *manualExport) shutdown(ctx context.Context) error {
+	if err := m.export(ctx); err != nil {
+		log.Println("Failed to export metrics on shutdown:", err)
+	}
+	return m.exporter.Shutdown(ctx)
+}
+
+// ServeHTTP triggers an export on POST /export.
+func (m *manualExport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := m.export(r.Context()); err != nil {
+		log.Println("Failed to export metrics:", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+)
+
+// parseBuckets parses a comma-separated list of strictly increasing histogram
+// bucket boundaries.
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket boundary %q: %w", field, err)
+		}
+		if len(buckets) > 0 && b <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("bucket boundaries must be increasing, got %v after %v", b, buckets[len(buckets)-1])
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// formatBuckets formats bucket boundaries as accepted by parseBuckets.
+func formatBuckets(buckets []float64) string {
+	fields := make([]string, len(buckets))
+	for i, b := range buckets {
+		fields[i] = strconv.FormatFloat(b, 'f', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+// splitList parses a comma-separated list, ignoring empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
+
+// parseSLOThresholds parses a comma-separated list of registry
+// pattern=duration pairs, e.g. "registry.example.com=60s,*=5m".
+func parseSLOThresholds(s string) ([]pullmetrics.SLOThreshold, error) {
+	var thresholds []pullmetrics.SLOThreshold
+	for _, pair := range splitList(s) {
+		pattern, value, ok := strings.Cut(pair, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid SLO threshold %q, expected registry=duration", pair)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid registry pattern %q: %w", pattern, err)
+		}
+		threshold, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLO threshold for %q: %w", pattern, err)
+		}
+		thresholds = append(thresholds, pullmetrics.SLOThreshold{Pattern: pattern, Threshold: threshold})
+	}
+	return thresholds, nil
+}
+
+// messageTemplatesFlag collects repeated -message-templates name=regex flags.
+type messageTemplatesFlag []pullmetrics.MessageTemplate
+
+func (f *messageTemplatesFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	names := make([]string, len(*f))
+	for i, t := range *f {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *messageTemplatesFlag) Set(s string) error {
+	name, pattern, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid message template %q, expected name=regex", s)
+	}
+	t, err := pullmetrics.ParseMessageTemplate(strings.TrimSpace(name), pattern)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
+// headersFlag collects repeated -otlp-header key=value flags.
+type headersFlag map[string]string
+
+func (h headersFlag) String() string {
+	return redactHeaders(h)
+}
+
+func (h headersFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("invalid header %q, expected key=value", s)
+	}
+	h[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	return nil
+}
+
+// parseHeadersEnv parses headers in the OTEL_EXPORTER_OTLP_HEADERS format: a
+// comma-separated list of key=value pairs with URL-encoded values.
+func parseHeadersEnv(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid header value for %q: %w", key, err)
+		}
+		headers[strings.TrimSpace(key)] = value
+	}
+	return headers, nil
+}
+
+// otlpHeaders returns the headers sent with every OTLP export: env, the
+// OTEL_EXPORTER_OTLP_HEADERS value, with the -otlp-header flags merged over
+// it, so a flag wins over the environment for the same key.
+func otlpHeaders(env string, flags headersFlag) (map[string]string, error) {
+	headers, err := parseHeadersEnv(env)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	for k, v := range flags {
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+// redactHeaders formats headers for logging without revealing their values,
+// which commonly carry API keys.
+func redactHeaders(headers map[string]string) string {
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k+"=<redacted>")
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// signalEndpoint returns the OTLP endpoint of a signal: the signal specific
+// URL if set, otherwise the shared base URL with path appended, mirroring
+// OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT. It
+// returns "" when neither is set so the exporter falls back to those
+// environment variables.
+func signalEndpoint(signalURL, baseURL, path string) string {
+	if signalURL != "" {
+		return signalURL
+	}
+	if baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/") + path
+	}
+	return ""
+}
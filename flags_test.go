@@ -0,0 +1,127 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+)
+
+func TestOTLPHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		flags   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none", want: map[string]string{}},
+		{name: "env only", env: "api-key=env%20key, x-team=infra", want: map[string]string{"api-key": "env key", "x-team": "infra"}},
+		{name: "flags only", flags: []string{"api-key=flag", "x-team = platform"}, want: map[string]string{"api-key": "flag", "x-team": "platform"}},
+		{name: "flag wins", env: "api-key=env,x-team=infra", flags: []string{"api-key=flag"}, want: map[string]string{"api-key": "flag", "x-team": "infra"}},
+		{name: "invalid env", env: "api-key", wantErr: true},
+		{name: "invalid env value", env: "api-key=%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := headersFlag{}
+			for _, f := range tt.flags {
+				if err := flags.Set(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := otlpHeaders(tt.env, flags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("otlpHeaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("otlpHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadersFlagRejectsMissingValue(t *testing.T) {
+	for _, s := range []string{"api-key", "=value", " =value"} {
+		if err := (headersFlag{}).Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestOTLPHeadersReachCollector(t *testing.T) {
+	headers, err := otlpHeaders("api-key=env,x-team=infra", headersFlag{"api-key": "flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector, requests := newTestCollector(t)
+	exportOnce(t, meterProviderConfig{
+		exporters: []string{"otlp"},
+		endpoint:  collector.URL + "/v1/metrics",
+		headers:   headers,
+	})
+
+	select {
+	case req := <-requests:
+		if got := req.header.Get("api-key"); got != "flag" {
+			t.Errorf("api-key header = %q, want %q", got, "flag")
+		}
+		if got := req.header.Get("x-team"); got != "infra" {
+			t.Errorf("x-team header = %q, want %q", got, "infra")
+		}
+	default:
+		t.Error("collector received no OTLP export")
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	got := redactHeaders(map[string]string{"x-team": "infra", "api-key": "secret"})
+	if want := "api-key=<redacted>,x-team=<redacted>"; got != want {
+		t.Errorf("redactHeaders() = %q, want %q", got, want)
+	}
+}
+
+func TestSignalEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		signalURL string
+		baseURL   string
+		want      string
+	}{
+		{name: "signal endpoint wins", signalURL: "https://metrics.example:4318/custom", baseURL: "https://otel.example:4318", want: "https://metrics.example:4318/custom"},
+		{name: "signal endpoint only", signalURL: "https://metrics.example:4318/custom", want: "https://metrics.example:4318/custom"},
+		{name: "base endpoint", baseURL: "https://otel.example:4318", want: "https://otel.example:4318/v1/metrics"},
+		{name: "base endpoint with trailing slash", baseURL: "https://otel.example:4318/", want: "https://otel.example:4318/v1/metrics"},
+		{name: "base endpoint with path", baseURL: "https://otel.example/otlp", want: "https://otel.example/otlp/v1/metrics"},
+		{name: "neither", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signalEndpoint(tt.signalURL, tt.baseURL, "/v1/metrics"); got != tt.want {
+				t.Errorf("signalEndpoint(%q, %q) = %q, want %q", tt.signalURL, tt.baseURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSLOThresholds(t *testing.T) {
+	got, err := parseSLOThresholds(" Registry.Example.com=60s, *=5m ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pullmetrics.SLOThreshold{
+		{Pattern: "registry.example.com", Threshold: time.Minute},
+		{Pattern: "*", Threshold: 5 * time.Minute},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseSLOThresholds() = %v, want %v", got, want)
+	}
+
+	for _, s := range []string{"registry.example.com", "=60s", "registry.example.com=fast", "[=60s"} {
+		if _, err := parseSLOThresholds(s); err == nil {
+			t.Errorf("parseSLOThresholds(%q) succeeded, want error", s)
+		}
+	}
+}
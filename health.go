@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchHealth turns repeated watch errors into a failing /healthz, so a
+// liveness probe restarts the pod instead of it silently stopping to
+// receive events.
+var watchHealth = &clusterHealth{}
+
+// clusterHealth tracks the watch errors of each cluster separately, so
+// events from a healthy cluster can't mask another cluster's broken watch.
+type clusterHealth struct {
+	// threshold of consecutive watch errors that marks the process
+	// unhealthy, 0 disables it
+	threshold int64
+
+	mu       sync.Mutex
+	clusters []*watchErrors
+}
+
+// cluster returns the watch error count of a new cluster, named name or ""
+// when only one is watched.
+func (h *clusterHealth) cluster(name string) *watchErrors {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w := &watchErrors{cluster: name, threshold: h.threshold}
+	h.clusters = append(h.clusters, w)
+	return w
+}
+
+// failing returns the first cluster whose watch reached the threshold, or
+// nil if all are healthy.
+func (h *clusterHealth) failing() *watchErrors {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, w := range h.clusters {
+		if !w.healthy() {
+			return w
+		}
+	}
+	return nil
+}
+
+type watchErrors struct {
+	cluster     string
+	threshold   int64
+	consecutive atomic.Int64
+}
+
+// handleWatchError is registered as the informer's watch error handler.
+// Expired resource versions and closed watches are part of normal operation
+// and don't count.
+func (w *watchErrors) handleWatchError(r *cache.Reflector, err error) {
+	cache.DefaultWatchErrorHandler(r, err)
+	if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || errors.Is(err, io.EOF) {
+		return
+	}
+	if w.consecutive.Add(1) == w.threshold {
+		log.Println(w.describe(), "failed", w.threshold, "times in a row, reporting unhealthy:", err)
+	}
+}
+
+// eventReceived resets the error count, since the watch evidently works.
+func (w *watchErrors) eventReceived() {
+	if w.consecutive.Load() != 0 {
+		w.consecutive.Store(0)
+	}
+}
+
+func (w *watchErrors) healthy() bool {
+	return w.threshold <= 0 || w.consecutive.Load() < w.threshold
+}
+
+// describe names the watch in logs and responses.
+func (w *watchErrors) describe() string {
+	if w.cluster == "" {
+		return "Events watch"
+	}
+	return fmt.Sprintf("Events watch of cluster %q", w.cluster)
+}
+
+// serveHealthz responds 200 while healthy and 503 naming the failing
+// cluster otherwise.
+func serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	if failing := watchHealth.failing(); failing != nil {
+		http.Error(w, failing.describe()+" is failing", http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestHealthzPerCluster(t *testing.T) {
+	reflector := cache.NewReflector(&cache.ListWatch{}, &v1.Event{}, cache.NewStore(cache.MetaNamespaceKeyFunc), 0)
+	watchFailed := errors.New("connection refused")
+
+	tests := []struct {
+		name string
+		// errors and events of each cluster, in order: 'e' is a watch
+		// error, '.' a received event
+		clusters   map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "healthy",
+			clusters:   map[string]string{"a": "ee.", "b": "."},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "single cluster failing",
+			clusters:   map[string]string{"": "eee"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "Events watch is failing",
+		},
+		{
+			name:       "events of another cluster don't reset errors",
+			clusters:   map[string]string{"a": "eee", "b": "..."},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `Events watch of cluster "a" is failing`,
+		},
+		{
+			name:       "below threshold",
+			clusters:   map[string]string{"a": "ee", "b": "ee"},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := watchHealth
+			t.Cleanup(func() { watchHealth = previous })
+			watchHealth = &clusterHealth{threshold: 3}
+
+			for name, history := range tt.clusters {
+				health := watchHealth.cluster(name)
+				for _, c := range history {
+					if c == 'e' {
+						health.handleWatchError(reflector, watchFailed)
+					} else {
+						health.eventReceived()
+					}
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			serveHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.wantStatus || strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("/healthz = %d %q, want %d %q", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerSync records the Unix time in seconds an events informer last
+// delivered an event or finished its initial sync, 0 before that.
+type informerSync struct {
+	last atomic.Int64
+}
+
+func (s *informerSync) mark() {
+	s.last.Store(time.Now().Unix())
+}
+
+// registerInformerGauges reports the number of events held by the events
+// informer's store and when it last synced, with attributes, to tell
+// informer problems apart from parsing problems when metrics go missing.
+func registerInformerGauges(meter metric.Meter, informer cache.SharedIndexInformer, synced *informerSync, attributes metric.ObserveOption) error {
+	cacheSize, err := meter.Int64ObservableGauge(
+		"k8s.image.pull.informer.cache_size",
+		metric.WithDescription("The number of events held by the events informer's cache."),
+	)
+	if err != nil {
+		return err
+	}
+	lastSync, err := meter.Int64ObservableGauge(
+		"k8s.image.pull.informer.last_sync",
+		metric.WithDescription("The Unix time the events informer last delivered an event or finished its initial sync."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(cacheSize, int64(len(informer.GetStore().ListKeys())), attributes)
+		if t := synced.last.Load(); t > 0 {
+			o.ObserveInt64(lastSync, t, attributes)
+		}
+		return nil
+	}, cacheSize, lastSync)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// int64Points returns the data points of the int64 gauge or sum named name.
+func int64Points(t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var points []metricdata.DataPoint[int64]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				points = append(points, data.DataPoints...)
+			case metricdata.Sum[int64]:
+				points = append(points, data.DataPoints...)
+			default:
+				t.Fatalf("unexpected data %T of %s", data, name)
+			}
+		}
+	}
+	return points
+}
+
+func TestInformerGauges(t *testing.T) {
+	informer := informers.NewSharedInformerFactory(fake.NewClientset(), 0).Core().V1().Events().Informer()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	synced := &informerSync{}
+	attributes := metric.WithAttributes(attribute.String("k8s.cluster.name", "prod"))
+	if err := registerInformerGauges(meter, informer, synced, attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing synced yet
+	if got := int64Points(t, reader, "k8s.image.pull.informer.cache_size"); len(got) != 1 || got[0].Value != 0 {
+		t.Errorf("cache_size before any event = %+v, want 0", got)
+	}
+	if got := int64Points(t, reader, "k8s.image.pull.informer.last_sync"); len(got) != 0 {
+		t.Errorf("last_sync before the initial sync = %+v, want no data points", got)
+	}
+
+	for _, name := range []string{"web-1.a", "web-1.b", "web-2.a"} {
+		event := &v1.Event{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault}}
+		if err := informer.GetStore().Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := time.Now().Unix()
+	synced.mark()
+
+	cacheSize := int64Points(t, reader, "k8s.image.pull.informer.cache_size")
+	if len(cacheSize) != 1 || cacheSize[0].Value != 3 {
+		t.Fatalf("cache_size = %+v, want 3", cacheSize)
+	}
+	if v, _ := cacheSize[0].Attributes.Value("k8s.cluster.name"); v.AsString() != "prod" {
+		t.Errorf("cache_size cluster = %q, want prod", v.AsString())
+	}
+	lastSync := int64Points(t, reader, "k8s.image.pull.informer.last_sync")
+	if len(lastSync) != 1 || lastSync[0].Value < before || lastSync[0].Value > time.Now().Unix() {
+		t.Errorf("last_sync = %+v, want the time of mark around %d", lastSync, before)
+	}
+}
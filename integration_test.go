@@ -0,0 +1,151 @@
+//go:build integration
+
+// The integration tests run the event pipeline against a real API server
+// started by envtest. They need its etcd and kube-apiserver binaries, e.g.
+//
+//	export KUBEBUILDER_ASSETS=$(setup-envtest use 1.32.0 -p path)
+//	go test -tags integration ./...
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func TestWatchEventsRecordsPulls(t *testing.T) {
+	env := &envtest.Environment{}
+	config, err := env.Start()
+	if err != nil {
+		t.Fatalf("starting envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("stopping envtest: %v", err)
+		}
+	})
+	client := kubernetes.NewForConfigOrDie(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	// one pipeline per events API, all fed by the same events
+	readers := map[string]*sdkmetric.ManualReader{}
+	for _, eventsAPI := range []string{"core", "events"} {
+		reader := sdkmetric.NewManualReader()
+		meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+		factory := informers.NewSharedInformerFactory(client, 0)
+		handler, err := pullmetrics.New(meter, pullmetrics.WithLookups(client, factory, 5, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := watchEvents(ctx, meter, factory, handler, eventsAPI, "", 30*time.Second, stopCh); err != nil {
+			t.Fatalf("watching %s events: %v", eventsAPI, err)
+		}
+		readers[eventsAPI] = reader
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f7c9b4-x2x7k", Namespace: metav1.NamespaceDefault},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web", Image: "nginx:1.27"}}},
+	}
+	pod, err = client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	for i, e := range []struct{ reason, message string }{
+		{"Pulling", `Pulling image "nginx:1.27"`},
+		{"Pulled", `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1000 bytes.`},
+	} {
+		event := &v1.Event{
+			ObjectMeta: metav1.ObjectMeta{GenerateName: pod.Name + ".", Namespace: pod.Namespace},
+			InvolvedObject: v1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				UID:       pod.UID,
+				FieldPath: "spec.containers{web}",
+			},
+			Reason:         e.reason,
+			Message:        e.message,
+			Type:           v1.EventTypeNormal,
+			Source:         v1.EventSource{Component: "kubelet", Host: "node-1"},
+			FirstTimestamp: now,
+			LastTimestamp:  metav1.NewTime(now.Add(time.Duration(i) * time.Second)),
+			Count:          1,
+		}
+		if _, err := client.CoreV1().Events(pod.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for eventsAPI, reader := range readers {
+		t.Run(eventsAPI, func(t *testing.T) {
+			var durations metricdata.HistogramDataPoint[int64]
+			var inFlight int64 = -1
+			deadline := time.Now().Add(30 * time.Second)
+			for time.Now().Before(deadline) {
+				var rm metricdata.ResourceMetrics
+				if err := reader.Collect(ctx, &rm); err != nil {
+					t.Fatal(err)
+				}
+				durations, inFlight = pullMetrics(rm)
+				if durations.Count > 0 && inFlight == 0 {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			if durations.Count != 1 || durations.Sum != 1500 {
+				t.Errorf("k8s.image.pull.duration count %d sum %d, want 1 pull of 1500ms", durations.Count, durations.Sum)
+			}
+			if v, ok := durations.Attributes.Value("exported.namespace"); !ok || v.AsString() != pod.Namespace {
+				t.Errorf("exported.namespace = %q, want %q", v.AsString(), pod.Namespace)
+			}
+			if v, ok := durations.Attributes.Value("exported.host"); !ok || v.AsString() != "node-1" {
+				t.Errorf("exported.host = %q, want node-1", v.AsString())
+			}
+			if inFlight != 0 {
+				t.Errorf("k8s.image.pull.in_flight = %d after the Pulled event, want 0", inFlight)
+			}
+		})
+	}
+}
+
+// pullMetrics returns the data point of k8s.image.pull.duration and the sum
+// of k8s.image.pull.in_flight in rm, -1 if the latter wasn't recorded.
+func pullMetrics(rm metricdata.ResourceMetrics) (metricdata.HistogramDataPoint[int64], int64) {
+	var durations metricdata.HistogramDataPoint[int64]
+	var inFlight int64 = -1
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch m.Name {
+			case "k8s.image.pull.duration":
+				if data, ok := m.Data.(metricdata.Histogram[int64]); ok && len(data.DataPoints) > 0 {
+					durations = data.DataPoints[0]
+				}
+			case "k8s.image.pull.in_flight":
+				if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+					inFlight = 0
+					for _, dp := range data.DataPoints {
+						inFlight += dp.Value
+					}
+				}
+			}
+		}
+	}
+	return durations, inFlight
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// setCAFile makes config verify the API server against the CA bundle at path
+// instead of the one it was loaded with, e.g. when running in-cluster behind
+// a proxy that the service account CA doesn't cover. The file is read once
+// to fail at startup rather than on the first request.
+func setCAFile(config *rest.Config, path string) error {
+	if _, err := os.ReadFile(path); err != nil {
+		return fmt.Errorf("reading Kubernetes API CA file: %w", err)
+	}
+	config.TLSClientConfig.CAFile = path
+	// CAData takes precedence over CAFile
+	config.TLSClientConfig.CAData = nil
+	return nil
+}
+
+// cluster is a Kubernetes cluster whose events are watched.
+type cluster struct {
+	// name is recorded as the k8s.cluster.name attribute, empty when only a
+	// single cluster is watched
+	name      string
+	clientset *kubernetes.Clientset
+}
+
+// loadClusters returns a cluster per kubeconfig context in contexts, named
+// after the context when there are several. Without contexts it returns the
+// in-cluster config, or the current context of kubeconfig if set. caFile,
+// if set, replaces the CA bundle of every cluster.
+func loadClusters(kubeconfig string, contexts []string, caFile string) ([]cluster, error) {
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	var clusters []cluster
+	for _, kubeContext := range contexts {
+		config, err := loadConfig(kubeconfig, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		if caFile != "" {
+			if err := setCAFile(config, caFile); err != nil {
+				return nil, err
+			}
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("creating Kubernetes client: %w", err)
+		}
+		c := cluster{clientset: clientset}
+		if len(contexts) > 1 {
+			c.name = kubeContext
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
+
+// loadConfig loads the config of kubeContext from kubeconfig, falling back
+// to the current context and to the in-cluster config if they're empty.
+func loadConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeContext != "" {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("loading kubeconfig context %q: %w", kubeContext, err)
+		}
+		return config, nil
+	}
+	// Use in-cluster config if kubeconfig is not provided
+	if kubeconfig == "" {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("loading in-cluster config: %w", err)
+		}
+		return config, nil
+	}
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestSetCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the loaded CA, e.g. the service account's, doesn't cover the server
+	config := &rest.Config{Host: server.URL, TLSClientConfig: rest.TLSClientConfig{CAData: []byte("loaded CA")}}
+	if err := setCAFile(config, caFile); err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSClientConfig.CAFile != caFile || config.TLSClientConfig.CAData != nil {
+		t.Fatalf("TLS config = %+v, want only CAFile %s", config.TLSClientConfig, caFile)
+	}
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request verified against the CA file failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSetCAFileMissing(t *testing.T) {
+	config := &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("loaded CA")}}
+	err := setCAFile(config, filepath.Join(t.TempDir(), "missing.crt"))
+	if err == nil || !strings.Contains(err.Error(), "reading Kubernetes API CA file") {
+		t.Fatalf("setCAFile() = %v, want a reading error", err)
+	}
+	// a failed call leaves the loaded CA in place
+	if config.TLSClientConfig.CAFile != "" || string(config.TLSClientConfig.CAData) != "loaded CA" {
+		t.Errorf("TLS config = %+v, want it unchanged", config.TLSClientConfig)
+	}
+}
+
+func TestLoadClustersCAFileMissing(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadClusters(kubeconfig, nil, filepath.Join(t.TempDir(), "missing.crt"))
+	if err == nil || !strings.Contains(err.Error(), "reading Kubernetes API CA file") {
+		t.Fatalf("loadClusters() = %v, want a reading error", err)
+	}
+}
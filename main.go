@@ -2,97 +2,282 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"regexp"
-	"strconv"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
-	v1 "k8s.io/api/core/v1"
+	"k8s-image-pull-metrics/pullmetrics"
+
 	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/metric"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
-)
-
-var (
-	config                        *rest.Config
-	durationPullHistogram         metric.Int64Histogram
-	durationPullWaitOnlyHistogram metric.Int64Histogram
-	imageSizeGauge                metric.Int64Gauge
+	"golang.org/x/net/http/httpproxy"
 )
 
 func main() {
-	var kubeconfig *string
+	if err := run(flag.CommandLine, os.Args[1:]); err != nil {
+		slog.Error("Exiting", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run parses args into fs, starts watching events and blocks until the
+// process is asked to terminate or the HTTP listener fails. Errors preventing
+// startup are returned rather than panicking.
+func run(fs *flag.FlagSet, args []string) error {
+	kubeconfig := new(string)
 	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+		kubeconfig = fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	}
+	configFile := fs.String("config", "", "YAML or JSON file of flag values keyed by flag name. Flags given on the command line take precedence")
+	kubeContext := fs.String("context", "", "Comma-separated kubeconfig contexts to watch. With several, each cluster's metrics carry its context as the k8s.cluster.name attribute")
+	k8sCAFile := fs.String("k8s-ca-file", "", "Path to a CA bundle used to verify the Kubernetes API server instead of the default one")
+	lookupQPS := fs.Float64("lookup-qps", 5, "Maximum rate of direct API server lookups for objects missing from the local cache")
+	lookupBurst := fs.Int("lookup-burst", 10, "Burst size for direct API server lookups")
+	attributePrefix := fs.String("attribute-prefix", "exported.", "Prefix prepended to the names of the recorded pod and image attributes")
+	headerFlags := headersFlag{}
+	fs.Var(headerFlags, "otlp-header", "Header sent with every OTLP export as key=value, e.g. an API key. Repeatable, merged over OTEL_EXPORTER_OTLP_HEADERS")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "Base URL of the OTLP collector, /v1/metrics is appended (default OTEL_EXPORTER_OTLP_ENDPOINT)")
+	otlpMetricsEndpoint := fs.String("otlp-metrics-endpoint", "", "Full URL OTLP metrics are sent to, overriding -otlp-endpoint (default OTEL_EXPORTER_OTLP_METRICS_ENDPOINT)")
+	otlpProxy := fs.String("otlp-proxy", "", "Proxy URL OTLP exports are sent through, overriding HTTPS_PROXY, HTTP_PROXY and NO_PROXY")
+	waitForCollectorTimeout := fs.Duration("wait-for-collector", 0, "Before watching events, wait up to this long for the OTLP endpoint to accept connections, exiting with an error if it doesn't (0 disables)")
+	otlpTimeout := fs.Duration("otlp-timeout", 0, "Timeout of each OTLP export request (default 10s, or OTEL_EXPORTER_OTLP_TIMEOUT)")
+	otlpMaxDataPoints := fs.Int("otlp-max-data-points", 0, "Split OTLP exports into requests of at most this many data points (0 disables)")
+	temporalityName := fs.String("temporality", "cumulative", "Aggregation temporality of OTLP exported counters and histograms: cumulative or delta")
+	temporalityByKind := fs.String("temporality-by-kind", "", "Comma-separated kind=temporality pairs overriding -temporality per instrument kind, e.g. histogram=delta,counter=cumulative")
+	exporters := fs.String("exporter", "otlp", "Comma-separated list of metric exporters to enable: otlp, prometheus")
+	textfilePath := fs.String("textfile-path", "", "Also write the metrics in the Prometheus text format to this file every 30s, for the node exporter textfile collector (name it *.prom)")
+	manualReader := fs.Bool("manual-reader", false, "Only export OTLP metrics when POST /export is called instead of every 30s")
+	enablePprof := fs.Bool("enable-pprof", false, "Serve net/http/pprof profiling endpoints on -pprof-address")
+	pprofAddress := fs.String("pprof-address", "localhost:6060", "Address the pprof endpoints listen on, separate from -http-address")
+	httpAddress := fs.String("http-address", ":8080", "Address the HTTP endpoints (/healthz, /debug/stats, /metrics, /export) listen on")
+	var messageTemplates messageTemplatesFlag
+	fs.Var(&messageTemplates, "message-templates", "Regex matching Pulled event messages as name=regex, with capture groups named image, pull and optionally wait and size. Repeatable, tried in order before the built-in templates")
+	aggregationMode := fs.String("aggregation-mode", "detailed", "Attributes pulls are recorded with: detailed, or coarse for only namespace, registry and node pool")
+	histogramType := fs.String("histogram-type", "explicit", "Aggregation of the pull duration histograms: explicit (buckets from -duration-buckets) or exponential")
+	cardinalityLimit := fs.Int("cardinality-limit", 0, "Maximum number of series per instrument, collapsing further attribute sets into one with otel.metric.overflow=true (0 leaves OTEL_GO_X_CARDINALITY_LIMIT as set in the environment, unlimited by default)")
+	histogramMinMax := fs.Bool("histogram-min-max", true, "Record the minimum and maximum of the pull duration histograms in OTLP exports, e.g. to find the slowest pull of each export interval")
+	durationBuckets := fs.String("duration-buckets", formatBuckets(pullmetrics.DefaultDurationBuckets), "Comma-separated bucket boundaries in ms for the pull duration histograms")
+	waitDurationBuckets := fs.String("wait-duration-buckets", formatBuckets(pullmetrics.DefaultWaitDurationBuckets), "Comma-separated bucket boundaries in ms for the wait-only duration histogram")
+	recordTimeout := fs.Duration("record-timeout", 5*time.Second, "Maximum time to wait for metrics of a single event to be recorded")
+	inFlightTTL := fs.Duration("in-flight-ttl", 30*time.Minute, "How long a started pull is counted as in flight without a matching Pulled or Failed event")
+	parseCheck := fs.String("parse-check", "", "Parse the Pulled event messages in this file (- for stdin), one per line, print the result of each and exit, failing if any doesn't parse")
+	debugLogRecords := fs.Bool("debug-log-records", false, "Log every measurement the handler records, with its instrument, value and attributes, before aggregation")
+	selftest := fs.Bool("selftest", false, "Check access to the cluster and the metrics backend, emit one synthetic metric and exit")
+	sourceHandlerAttribute := fs.Bool("source-handler-attribute", false, "Record which informer handler (add or update) delivered the event as the event.source_handler attribute")
+	cacheMaxEntries := fs.Int("cache-max-entries", 10000, "Maximum number of entries kept by each in-memory correlation cache before evicting the least recently used")
+	alertWebhook := fs.String("alert-webhook", "", "http(s) URL to POST a JSON alert to for every pull slower than -alert-threshold, e.g. stuck pulls")
+	alertThreshold := fs.Duration("alert-threshold", 10*time.Minute, "Pull duration above which -alert-webhook is notified")
+	alertInterval := fs.Duration("alert-interval", 15*time.Minute, "Minimum time between two alerts for the same node")
+	enablePercentiles := fs.Bool("enable-percentiles", false, "Report the p50, p95 and p99 pull duration of each registry within -percentile-window as gauges, for backends without good histogram support")
+	percentileWindow := fs.Duration("percentile-window", 10*time.Minute, "Sliding window of pull durations the -enable-percentiles gauges are computed over, capped at the most recent 1000 pulls per registry")
+	emitK8sEvents := fs.Bool("emit-k8s-events", false, "Create a Warning Event on Nodes whose pulls are chronically slow, see -slow-node-threshold, -slow-node-pulls and -slow-node-window")
+	slowNodeThreshold := fs.Duration("slow-node-threshold", 5*time.Minute, "Pull duration above which a pull counts as slow for -emit-k8s-events")
+	slowNodePulls := fs.Int("slow-node-pulls", 3, "Number of consecutive slow pulls after which -emit-k8s-events creates an Event on the node")
+	slowNodeWindow := fs.Duration("slow-node-window", time.Hour, "Window the consecutive slow pulls must occur in, and minimum time between two Events for the same node")
+	recordsSink := fs.String("records-sink", "none", "Where to stream parsed pulls as JSON: none, stdout, or an http(s) URL to POST each record to")
+	sourceComponent := fs.String("source-component", "kubelet", "Only process events emitted by this component, matched case-insensitively against the start of the event's source or reporting controller")
+	maxEventAge := fs.Duration("max-event-age", 0, "Ignore events last observed longer ago than this, e.g. the backlog replayed on startup (0 disables)")
+	sampleRate := fs.Float64("sample-rate", 1, "Fraction of parsed pulls to record, between 0 and 1, chosen by a hash of the event UID. All pulls are still counted in k8s.image.pulls")
+	minPullDuration := fs.Duration("min-pull-duration", 0, "Pulls faster than this are counted in k8s.image.pull.cached instead of the duration histograms")
+	flapThreshold := fs.Int("flap-threshold", 0, "Pulls a single pod may record within -flap-window before further pulls are only counted in k8s.image.pull.flapping (0 disables)")
+	flapWindow := fs.Duration("flap-window", 10*time.Minute, "Window over which -flap-threshold is counted")
+	repullWindow := fs.Duration("repull-window", 0, "Count a pull in k8s.image.repull when the same node pulled the same image within this window (0 disables)")
+	fs.Int64Var(&exportBreaker.threshold, "breaker-threshold", 0, "Consecutive failed exports after which object lookups are skipped until an export succeeds (0 disables). Only use it with -temporality=delta, as cumulative exports deliver the measurements recorded meanwhile, without the attributes lookups derive")
+	snapshotterLabel := fs.String("snapshotter-label", "", "Node label, or annotation if there's no such label, recorded as the node.snapshotter attribute, e.g. the containerd snapshotter. Left out when empty or the node has neither")
+	nodePoolLabel := fs.String("node-pool-label", "", "Node label recorded as the node.pool attribute. When empty, well-known node pool labels of GKE, EKS, Karpenter, AKS and DOKS are tried")
+	fs.Int64Var(&watchHealth.threshold, "watch-error-threshold", 5, "Consecutive events watch errors after which /healthz reports unhealthy (0 disables)")
+	sizeGrowthThreshold := fs.Float64("size-growth-threshold", 0, "Record k8s.image.size.growth when an image tag's size grew by more than this percentage since its previous pull (0 disables)")
+	sloThresholds := fs.String("slo-thresholds", "", "Comma-separated registry=duration pairs counting pulls from matching registries slower than the duration in k8s.image.pull.slo_violations, e.g. registry.example.com=60s,*=5m. Registries are matched with shell patterns, the first match applies")
+	registryAllowlist := fs.String("registry-allowlist", "", "Comma-separated registry hosts to record pulls from, all others are ignored (docker.io matches images without a registry)")
+	registryDenylist := fs.String("registry-denylist", "", "Comma-separated registry hosts whose pulls are ignored, e.g. registry.k8s.io")
+	eventsAPI := fs.String("events-api", "core", "API to watch events through: core (core/v1) or events (events.k8s.io/v1)")
+	enrichFromRegistry := fs.Bool("enrich-from-registry", false, "Fetch the manifest of pulled images from their registry to record k8s.image.layer.count")
+	registryConfig := fs.String("registry-config", "", "Docker config.json with registry credentials used by -enrich-from-registry")
+	namespaceLabel := fs.String("namespace-label", "", "Namespace label recorded as the team attribute, e.g. team")
+	syncTimeout := fs.Duration("sync-timeout", 0, "Exit with an error if the informer caches don't sync within this time after startup, e.g. while the API server is unreachable (0 waits indefinitely)")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "How long to wait for the final flush on shutdown. Keep it below the pod's terminationGracePeriodSeconds")
+	relabelConfig := fs.String("relabel-config", "", "YAML or JSON file of rules rewriting attribute values matching a regex, applied before recording")
+	disabledMetrics := fs.String("disabled-metrics", "", "Comma-separated instrument names, e.g. k8s.image.pull.wait_ratio, that are never created or recorded")
+	viewsFile := fs.String("views-file", "", "YAML or JSON file of view rules renaming instruments or dropping instruments and attributes")
+	failureTTL := fs.Duration("failure-ttl", 30*time.Minute, "How long a failed pull is remembered when correlating it with a later successful pull")
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
-	ctx := flag.String("context", "", "The name of the kubeconfig context to use")
-	flag.Parse()
 
-	var err error
-	// Use in-cluster config if kubeconfig is not provided
-	if *kubeconfig == "" {
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			panic(err.Error())
-		}
-	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-		if err != nil {
-			panic(err.Error())
+	// flags given on the command line also take precedence on reload
+	onCommandLine := setFlags(fs)
+	if *configFile != "" {
+		if err := applyConfigFile(fs, *configFile); err != nil {
+			return fmt.Errorf("loading -config: %w", err)
 		}
 	}
 
-	// Override the context if specified
-	if *ctx != "" {
-		configOverrides := &clientcmd.ConfigOverrides{CurrentContext: *ctx}
-		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			&clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeconfig},
-			configOverrides,
-		).ClientConfig()
+	if *aggregationMode != string(pullmetrics.AggregationDetailed) && *aggregationMode != string(pullmetrics.AggregationCoarse) {
+		return fmt.Errorf("unknown aggregation mode %q, expected detailed or coarse", *aggregationMode)
+	}
+
+	if *cacheMaxEntries <= 0 {
+		return fmt.Errorf("-cache-max-entries must be positive, got %d", *cacheMaxEntries)
+	}
+
+	if *parseCheck != "" {
+		return runParseCheck(*parseCheck, append(messageTemplates, pullmetrics.DefaultMessageTemplates...), os.Stdout)
+	}
+
+	// runtimeOptions returns the Handler options a reload of -config can
+	// change, see reloadableFlags
+	runtimeOptions := func() ([]pullmetrics.Option, error) {
+		if *sampleRate < 0 || *sampleRate > 1 {
+			return nil, fmt.Errorf("-sample-rate must be between 0 and 1, got %v", *sampleRate)
+		}
+		slos, err := parseSLOThresholds(*sloThresholds)
 		if err != nil {
-			panic(err.Error())
+			return nil, fmt.Errorf("parsing -slo-thresholds: %w", err)
 		}
+		var relabelRules []pullmetrics.RelabelRule
+		if *relabelConfig != "" {
+			relabelRules, err = loadRelabelRules(*relabelConfig)
+			if err != nil {
+				return nil, fmt.Errorf("loading -relabel-config: %w", err)
+			}
+		}
+		return []pullmetrics.Option{
+			pullmetrics.WithRelabelRules(relabelRules...),
+			pullmetrics.WithMinPullDuration(*minPullDuration),
+			pullmetrics.WithSampleRate(*sampleRate),
+			pullmetrics.WithMaxEventAge(*maxEventAge),
+			pullmetrics.WithSLOThresholds(slos...),
+			pullmetrics.WithSizeGrowthThreshold(*sizeGrowthThreshold),
+			pullmetrics.WithRegistryFilter(splitList(*registryAllowlist), splitList(*registryDenylist)),
+			pullmetrics.WithNodePoolLabel(*nodePoolLabel),
+			pullmetrics.WithSnapshotterLabel(*snapshotterLabel),
+		}, nil
+	}
+	reloadable, err := runtimeOptions()
+	if err != nil {
+		return err
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	buckets, err := parseBuckets(*durationBuckets)
 	if err != nil {
-		panic(err.Error())
+		return fmt.Errorf("parsing -duration-buckets: %w", err)
+	}
+	waitBuckets, err := parseBuckets(*waitDurationBuckets)
+	if err != nil {
+		return fmt.Errorf("parsing -wait-duration-buckets: %w", err)
+	}
+
+	clusters, err := loadClusters(*kubeconfig, splitList(*kubeContext), *k8sCAFile)
+	if err != nil {
+		return err
 	}
 
+	records, err := pullmetrics.NewRecordSink(*recordsSink)
+	if err != nil {
+		return err
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM, which stops recording and starts shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// OpenTelemetry metrics initialization
 	res, err := newResource()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("creating resource: %w", err)
 	}
 
 	// Create a meter provider.
 	// You can pass this instance directly to your instrumented code if it
 	// accepts a MeterProvider instance.
-	meterProvider, err := newMeterProvider(context.Background(), res)
+	mux := http.NewServeMux()
+	exporterNames := strings.Split(*exporters, ",")
+	// WithHeaders replaces the headers the exporter reads from the
+	// environment, so merge the flags over them explicitly
+	headers, err := otlpHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), headerFlags)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if len(headers) > 0 {
+		log.Println("Sending OTLP headers:", redactHeaders(headers))
 	}
 
-	// Handle shutdown properly so nothing leaks.
-	defer func() {
-		if err := meterProvider.Shutdown(context.Background()); err != nil {
-			log.Println(err)
+	histograms, err := histogramAggregations(*histogramType, *histogramMinMax, buckets, waitBuckets)
+	if err != nil {
+		return err
+	}
+	var viewRules []viewRule
+	if *viewsFile != "" {
+		viewRules, err = loadViewRules(*viewsFile)
+		if err != nil {
+			return fmt.Errorf("loading -views-file: %w", err)
 		}
-	}()
+	}
+	views := newViews(histograms, viewRules)
+	temporality, err := temporalitySelector(*temporalityName)
+	if err != nil {
+		return err
+	}
+	temporality, err = overrideTemporality(temporality, *temporalityByKind)
+	if err != nil {
+		return fmt.Errorf("parsing -temporality-by-kind: %w", err)
+	}
+	metricsEndpoint := signalEndpoint(*otlpMetricsEndpoint, *otlpEndpoint, "/v1/metrics")
+	if u, err := url.Parse(metricsEndpoint); err != nil || metricsEndpoint != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid OTLP metrics endpoint %q, expected an http or https URL", metricsEndpoint)
+	}
+	var proxy *url.URL
+	if *otlpProxy != "" {
+		proxy, err = url.Parse(*otlpProxy)
+		if err != nil || proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" {
+			return fmt.Errorf("invalid -otlp-proxy %q, expected an http, https or socks5 URL", *otlpProxy)
+		}
+	}
+	if *cardinalityLimit < 0 {
+		return fmt.Errorf("invalid -cardinality-limit %d, expected 0 or more", *cardinalityLimit)
+	}
+	if err := setCardinalityLimit(*cardinalityLimit); err != nil {
+		return err
+	}
+	meterProvider, manual, err := newMeterProvider(ctx, res, meterProviderConfig{
+		exporters:     exporterNames,
+		endpoint:      metricsEndpoint,
+		proxy:         proxy,
+		manualReader:  *manualReader,
+		textfilePath:  *textfilePath,
+		views:         views,
+		headers:       headers,
+		timeout:       *otlpTimeout,
+		temporality:   temporality,
+		maxDataPoints: *otlpMaxDataPoints,
+	}, mux)
+	if err != nil {
+		return fmt.Errorf("creating meter provider: %w", err)
+	}
+
+	// Handle shutdown properly so nothing leaks.
+	defer shutdownMeterProvider(meterProvider, manual, *shutdownTimeout)
 
 	// Register as global meter provider so that it can be used via otel.Meter
 	// and accessed using otel.GetMeterProvider.
@@ -101,114 +286,188 @@ func main() {
 	// is used, which fails to generate data.
 	otel.SetMeterProvider(meterProvider)
 
-	var meter = otel.Meter("pokgak.xyz/k8s-image-pull-metrics")
-	durationPullHistogram, _ = meter.Int64Histogram(
-		"k8s.image.pull.duration",
-		metric.WithDescription("The duration of image pull."),
-		metric.WithUnit("ms"),
-		metric.WithExplicitBucketBoundaries([]float64{15000, 30000, 45000, 60000, 120000, 180000, 240000, 300000}...),
-	)
-	durationPullWaitOnlyHistogram, _ = meter.Int64Histogram(
-		"k8s.image.pull_wait_only.duration",
-		metric.WithDescription("The duration of image pull including waiting time."),
-		metric.WithUnit("ms"),
-		metric.WithExplicitBucketBoundaries([]float64{15000, 30000, 45000, 60000, 120000, 180000, 240000, 300000}...),
-	)
-	imageSizeGauge, _ = meter.Int64Gauge(
-		"k8s.image.size",
-		metric.WithDescription("The size of the image in bytes."),
-		metric.WithUnit("bytes"),
-	)
-
-	// setup informer to watch for events
-	factory := informers.NewSharedInformerFactory(clientset, 0)
-	informer := factory.Core().V1().Events().Informer()
-
-	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: handleAddFunc,
-	})
+	var meter = disableInstruments(otel.Meter("pokgak.xyz/k8s-image-pull-metrics"), splitList(*disabledMetrics))
 
-	stopCh := make(chan struct{})
-	defer close(stopCh)
-
-	// Start the informer
-	go informer.Run(stopCh)
-
-	// Wait for the informer to sync
-	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
-		log.Fatalf("Error syncing cache")
+	if *waitForCollectorTimeout > 0 && slices.Contains(exporterNames, "otlp") {
+		address, err := collectorAddress(metricsEndpoint, proxy)
+		if err != nil {
+			return err
+		}
+		if err := waitForCollector(ctx, address, *waitForCollectorTimeout); err != nil {
+			return err
+		}
 	}
 
-	// Block forever
-	select {}
-}
-
-func handleAddFunc(obj interface{}) {
-	event, ok := obj.(*v1.Event)
-	if !ok {
-		return
+	if *selftest {
+		flush := meterProvider.ForceFlush
+		if manual != nil {
+			flush = manual.export
+		}
+		selftestCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		for _, c := range clusters {
+			if err := runSelfTest(selftestCtx, c.clientset, meter, flush); err != nil {
+				if c.name != "" {
+					return fmt.Errorf("self-test failed for cluster %q: %w", c.name, err)
+				}
+				return fmt.Errorf("self-test failed: %w", err)
+			}
+		}
+		log.Println("Self-test passed")
+		return nil
 	}
 
-	if event.Source.Component != "kubelet" || event.InvolvedObject.Kind != "Pod" || event.Reason != "Pulled" {
-		return
+	if *enablePprof {
+		go servePprof(*pprofAddress)
 	}
 
-	msg := event.Message
-	// skip if the message starts with "Container image" as it is not the message we are interested in
-	if len(msg) >= 15 && msg[:15] == "Container image" {
-		log.Println("Skipping event message:", msg)
-		return
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/debug/stats", serveDebugStats)
+	// listen before serving so an address in use fails startup, and report
+	// later failures through serveErr so the final flush still runs
+	listener, err := net.Listen("tcp", *httpAddress)
+	if err != nil {
+		return fmt.Errorf("listening on -http-address: %w", err)
 	}
+	server := &http.Server{Handler: mux}
+	defer server.Close()
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("Serving HTTP on", listener.Addr())
+		serveErr <- server.Serve(listener)
+	}()
 
-	log.Println("Pod event added: ", event.Message)
-
-	// input: "Successfully pulled image \"<account-id>.dkr.ecr.ap-southeast-1.amazonaws.com/example-service:99cd3b4\" in 1m44.643s (1m44.643s including waiting). Image size: 1169083618 bytes.",
-	// extract the image name, tag, duration pull, duration wait, and image size
-	var imageName, durationPullStr, durationWaitStr, imageSize string
-	n, err := fmt.Sscanf(msg, "Successfully pulled image %q in %s (%s including waiting). Image size: %s bytes.", &imageName, &durationPullStr, &durationWaitStr, &imageSize)
-	if err == nil && n == 4 {
-		durationPull, err := time.ParseDuration(durationPullStr)
-		if err != nil {
-			log.Println("Failed to parse durationPull:", err)
-			return
+	// only the measurements of the handlers are logged
+	handlerMeter := meter
+	if *debugLogRecords {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+		handlerMeter = debugMeter{meter}
+	}
+	handlerOpts := []pullmetrics.Option{
+		pullmetrics.WithAttributePrefix(*attributePrefix),
+		pullmetrics.WithSourceComponent(*sourceComponent),
+		pullmetrics.WithSourceHandlerAttribute(*sourceHandlerAttribute),
+		pullmetrics.WithAggregationMode(pullmetrics.AggregationMode(*aggregationMode)),
+		pullmetrics.WithDurationBuckets(buckets),
+		pullmetrics.WithWaitDurationBuckets(waitBuckets),
+		pullmetrics.WithMessageTemplates(messageTemplates...),
+		pullmetrics.WithRecordTimeout(*recordTimeout),
+		pullmetrics.WithCacheMaxEntries(*cacheMaxEntries),
+		pullmetrics.WithFailureTTL(*failureTTL),
+		pullmetrics.WithInFlightTTL(*inFlightTTL),
+		pullmetrics.WithFlapThreshold(*flapThreshold, *flapWindow),
+		pullmetrics.WithRepullWindow(*repullWindow),
+		pullmetrics.WithNamespaceLabel(*namespaceLabel),
+		pullmetrics.WithLookupsDisabledWhile(exportBreaker.isOpen),
+		pullmetrics.WithRecordSink(records),
+	}
+	handlerOpts = append(handlerOpts, reloadable...)
+	if *alertWebhook != "" {
+		handlerOpts = append(handlerOpts, pullmetrics.WithAlerts(*alertWebhook, *alertThreshold, *alertInterval))
+	}
+	if *enablePercentiles {
+		if *percentileWindow <= 0 {
+			return fmt.Errorf("-percentile-window must be positive, got %v", *percentileWindow)
 		}
-		durationWithWait, err := time.ParseDuration(durationWaitStr)
+		handlerOpts = append(handlerOpts, pullmetrics.WithPercentiles(*percentileWindow))
+	}
+	if *emitK8sEvents {
+		handlerOpts = append(handlerOpts, pullmetrics.WithNodeEvents(*slowNodeThreshold, *slowNodeWindow, *slowNodePulls))
+	}
+	if *enrichFromRegistry {
+		handlerOpts = append(handlerOpts, pullmetrics.WithRegistryEnrichment(*registryConfig))
+	}
+
+	// every cluster gets its own handler, sharing the instruments of meter,
+	// and its pods and nodes used for enrichment are served from the same
+	// factory its events are watched through
+	factories := make([]informers.SharedInformerFactory, len(clusters))
+	handlers := make([]*pullmetrics.Handler, len(clusters))
+	for i, c := range clusters {
+		factories[i] = informers.NewSharedInformerFactory(c.clientset, 0)
+		opts := append(slices.Clip(handlerOpts),
+			pullmetrics.WithLookups(c.clientset, factories[i], float32(*lookupQPS), *lookupBurst),
+			pullmetrics.WithClusterName(c.name),
+		)
+		handlers[i], err = pullmetrics.New(handlerMeter, opts...)
 		if err != nil {
-			log.Println("Failed to parse durationWait:", err)
-			return
+			return err
 		}
-		imageSizeInt, err := strconv.ParseInt(imageSize, 10, 64)
-		if err != nil {
-			log.Println("Failed to parse imageSize:", err)
-			return
+	}
+	publishStats(handlers...)
+	if err := registerBreakerGauge(meter); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, handler := range handlers {
+					handler.Sweep()
+				}
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		commonAttributes := []attribute.KeyValue{
-			attribute.Int64("observed.timestamp", event.LastTimestamp.UnixMilli()),
-			attribute.String("exported.namespace", event.Namespace),
-			attribute.String("exported.pod.image", imageName),
-			attribute.String("exported.host", event.Source.Host),
-		}
+	// SIGHUP re-reads -config and swaps the options of the handlers without
+	// losing the informer caches
+	if *configFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for {
+				select {
+				case <-hup:
+					log.Println("Reloading", *configFile)
+					if err := reloadConfigFile(fs, *configFile, onCommandLine); err != nil {
+						log.Println("Failed to reload -config, keeping the current options:", err)
+						continue
+					}
+					opts, err := runtimeOptions()
+					if err != nil {
+						log.Println("Failed to reload -config, keeping the current options:", err)
+						continue
+					}
+					for _, handler := range handlers {
+						handler.Reload(opts...)
+					}
+					log.Println("Reloaded", *configFile)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
 
-		// extract the prefix of the pod name
-		// given: k8s-image-pull-metrics-5f588dd8cf-8lnm4
-		// extract: k8s-image-pull-metrics
-		podName := event.InvolvedObject.Name
-		re := regexp.MustCompile(`^(.*)-.*-.*$`)
-		matches := re.FindStringSubmatch(podName)
-		if len(matches) > 1 {
-			commonAttributes = append(commonAttributes, attribute.String("exported.pod.prefix", matches[1]))
+	stopCh := make(chan struct{})
+	defer func() {
+		close(stopCh)
+		for _, factory := range factories {
+			factory.Shutdown()
+		}
+	}()
+	for i, c := range clusters {
+		if err := watchEvents(ctx, meter, factories[i], handlers[i], *eventsAPI, c.name, *syncTimeout, stopCh); err != nil {
+			return err
 		}
-		
-		imageSizeGauge.Record(context.Background(), imageSizeInt, metric.WithAttributes(commonAttributes...))
-		durationPullHistogram.Record(context.Background(), durationPull.Milliseconds(), metric.WithAttributes(commonAttributes...))
-		durationPullWaitOnlyHistogram.Record(context.Background(), time.Duration(durationWithWait - durationPull).Milliseconds(), metric.WithAttributes(commonAttributes...))
-
-		log.Println("Recorded metrics: durationPull:", durationPull.Seconds(), "durationWait:", time.Duration(durationWithWait - durationPull).Seconds(), "imageSize:", imageSizeInt)
 	}
-	if err != nil || n != 4 {
-		log.Println("Failed to parse event message:", err)
-		return
+	// All instruments exist by now.
+	for _, name := range unknownDisabled(meter) {
+		log.Println("Unknown -disabled-metrics instrument, ignoring:", name)
+	}
+
+	// Block until we're asked to terminate
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down")
+		return nil
+	case err := <-serveErr:
+		return fmt.Errorf("serving HTTP: %w", err)
 	}
 }
 
@@ -220,25 +479,137 @@ func newResource() (*resource.Resource, error) {
 		))
 }
 
-func newMeterProvider(ctx context.Context, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
-	opts := []otlpmetrichttp.Option{}
-	opts = append(opts, otlpmetrichttp.WithInsecure())
-	// opts = append(opts, otlpmetrichttp.WithEndpoint("http://collector.monitoring.svc.cluster.local:4318"))
-	// opts = append(opts, otlpmetrichttp.WithURLPath("/v1/metrics"))
-	opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+// meterProviderConfig configures newMeterProvider.
+type meterProviderConfig struct {
+	// exporters lists the exporters to register a reader for
+	exporters []string
+	// endpoint is the URL OTLP metrics are sent to, empty to use the
+	// OTEL_EXPORTER_OTLP_* environment variables
+	endpoint string
+	// proxy is the proxy OTLP exports are sent through, nil to use the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables
+	proxy *url.URL
+	// manualReader only exports OTLP metrics on demand via /export
+	manualReader bool
+	// textfilePath, if set, is periodically overwritten with the metrics in
+	// the Prometheus text format
+	textfilePath string
+	// views customize the aggregation of individual instruments
+	views []sdkmetric.View
+	// headers are sent with every OTLP export request
+	headers map[string]string
+	// timeout bounds each OTLP export request, 0 keeps the exporter default
+	timeout time.Duration
+	// temporality selects the OTLP aggregation temporality per instrument kind
+	temporality sdkmetric.TemporalitySelector
+	// maxDataPoints splits OTLP exports into requests of at most this many
+	// data points, 0 disables splitting
+	maxDataPoints int
+}
 
-	metricExporter, err := otlpmetrichttp.New(ctx, opts...)
-	if err != nil {
-		return nil, err
+// otlpProxy returns the proxy function of the OTLP exporter: proxy if set,
+// otherwise the one HTTPS_PROXY, HTTP_PROXY and NO_PROXY configure. Unlike
+// http.ProxyFromEnvironment, the environment is read on every call rather
+// than once per process.
+func otlpProxy(proxy *url.URL) otlpmetrichttp.HTTPTransportProxyFunc {
+	if proxy != nil {
+		return http.ProxyURL(proxy)
+	}
+	fromEnv := httpproxy.FromEnvironment().ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fromEnv(req.URL)
 	}
+}
 
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(
-			metricExporter,
-			sdkmetric.WithInterval(30*time.Second),
-		)),
-	)
+// shutdownMeterProvider flushes and shuts down meterProvider and manual, if
+// set, within timeout, so the final flush finishes within the pod's
+// termination grace period instead of being killed midway.
+func shutdownMeterProvider(meterProvider *sdkmetric.MeterProvider, manual *manualExport, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if manual != nil {
+		if err := manual.shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}
+	err := meterProvider.Shutdown(ctx)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Println("Final flush timed out after", timeout)
+	case err != nil:
+		log.Println("Final flush failed:", err)
+	default:
+		log.Println("Final flush completed")
+	}
+}
+
+// newMeterProvider registers one reader per entry in cfg.exporters on a
+// single provider, so the same instruments can be exported to several
+// backends at once: "otlp" pushes to the OTLP endpoint, every 30s or on
+// demand with cfg.manualReader, and "prometheus" serves /metrics on mux for
+// scraping. cfg.textfilePath is written until ctx is done. Shutting the
+// provider down flushes all of them.
+func newMeterProvider(ctx context.Context, res *resource.Resource, cfg meterProviderConfig, mux *http.ServeMux) (*sdkmetric.MeterProvider, *manualExport, error) {
+	providerOpts := []sdkmetric.Option{sdkmetric.WithResource(res), sdkmetric.WithView(cfg.views...)}
+	var manual *manualExport
+
+	for _, name := range cfg.exporters {
+		switch name {
+		case "otlp":
+			opts := []otlpmetrichttp.Option{}
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+			if cfg.endpoint != "" {
+				// the URL's scheme decides whether TLS is used
+				opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.endpoint))
+			}
+			opts = append(opts, otlpmetrichttp.WithProxy(otlpProxy(cfg.proxy)))
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+			if len(cfg.headers) > 0 {
+				opts = append(opts, otlpmetrichttp.WithHeaders(cfg.headers))
+			}
+			if cfg.timeout > 0 {
+				opts = append(opts, otlpmetrichttp.WithTimeout(cfg.timeout))
+			}
+			if cfg.temporality != nil {
+				opts = append(opts, otlpmetrichttp.WithTemporalitySelector(cfg.temporality))
+			}
+
+			otlpExporter, err := otlpmetrichttp.New(ctx, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			metricExporter := breakerExporter{batchingExporter{otlpExporter, cfg.maxDataPoints}}
+
+			if cfg.manualReader {
+				manual = newManualExport(metricExporter)
+				providerOpts = append(providerOpts, sdkmetric.WithReader(manual.reader))
+				mux.Handle("/export", manual)
+			} else {
+				providerOpts = append(providerOpts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(
+					metricExporter,
+					sdkmetric.WithInterval(30*time.Second),
+				)))
+			}
+		case "prometheus":
+			registry := prometheus.NewRegistry()
+			promExporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+			if err != nil {
+				return nil, nil, err
+			}
+			providerOpts = append(providerOpts, sdkmetric.WithReader(promExporter))
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		default:
+			return nil, nil, fmt.Errorf("unknown exporter %q, expected otlp or prometheus", name)
+		}
+	}
+
+	if cfg.textfilePath != "" {
+		textfile, err := newTextfileReader(ctx, cfg.textfilePath, 30*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		providerOpts = append(providerOpts, sdkmetric.WithReader(textfile))
+	}
 
-	return meterProvider, nil
+	return sdkmetric.NewMeterProvider(providerOpts...), manual, nil
 }
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:1
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+func TestRunErrors(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// an address that's already in use
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "unknown aggregation mode",
+			args:    []string{"-aggregation-mode=fine"},
+			wantErr: `unknown aggregation mode "fine"`,
+		},
+		{
+			name:    "non-positive cache size",
+			args:    []string{"-cache-max-entries=0"},
+			wantErr: "-cache-max-entries must be positive",
+		},
+		{
+			name:    "negative cardinality limit",
+			args:    []string{"-kubeconfig=" + kubeconfig, "-cardinality-limit=-1"},
+			wantErr: "invalid -cardinality-limit -1, expected 0 or more",
+		},
+		{
+			name:    "sample rate out of range",
+			args:    []string{"-sample-rate=2"},
+			wantErr: "-sample-rate must be between 0 and 1",
+		},
+		{
+			name:    "invalid buckets",
+			args:    []string{"-duration-buckets=1,x"},
+			wantErr: "parsing -duration-buckets",
+		},
+		{
+			name:    "missing config file",
+			args:    []string{"-config=" + filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: "loading -config",
+		},
+		{
+			name:    "HTTP address in use",
+			args:    []string{"-kubeconfig=" + kubeconfig, "-http-address=" + listener.Addr().String(), "-shutdown-timeout=100ms"},
+			wantErr: "listening on -http-address",
+		},
+		{
+			name:    "unreachable API server",
+			args:    []string{"-kubeconfig=" + kubeconfig, "-http-address=127.0.0.1:0", "-exporter=prometheus", "-sync-timeout=200ms", "-shutdown-timeout=100ms"},
+			wantErr: "didn't sync within 200ms",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("run(%q) = %v, want an error containing %q", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// otlpRequest is an OTLP export request received by a test collector.
+type otlpRequest struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newTestCollector returns a collector accepting OTLP exports, which it
+// sends to the returned channel.
+func newTestCollector(t *testing.T) (*httptest.Server, <-chan otlpRequest) {
+	t.Helper()
+	requests := make(chan otlpRequest, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- otlpRequest{path: r.URL.Path, header: r.Header.Clone(), body: body}
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// exportOnce records a counter through the provider of cfg and exports it
+// once through its manual reader, returning the serve mux the provider
+// registered its endpoints on.
+func exportOnce(t *testing.T, cfg meterProviderConfig) *http.ServeMux {
+	t.Helper()
+	cfg.manualReader = true
+	mux := http.NewServeMux()
+	provider, manual, err := newMeterProvider(context.Background(), resource.Empty(), cfg, mux)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	counter, err := provider.Meter("test").Int64Counter("k8s.image.pulls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.Add(context.Background(), 3)
+	if manual != nil {
+		if err := manual.export(context.Background()); err != nil {
+			t.Fatalf("exporting: %v", err)
+		}
+	}
+	return mux
+}
+
+func TestNewMeterProviderExportsToAllReaders(t *testing.T) {
+	collector, requests := newTestCollector(t)
+	mux := exportOnce(t, meterProviderConfig{
+		exporters: []string{"otlp", "prometheus"},
+		endpoint:  collector.URL + "/v1/metrics",
+	})
+
+	select {
+	case r := <-requests:
+		if r.path != "/v1/metrics" || len(r.body) == 0 {
+			t.Errorf("collector received %d bytes on %s, want metrics on /v1/metrics", len(r.body), r.path)
+		}
+	default:
+		t.Error("collector received no OTLP export")
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `k8s_image_pulls_total{otel_scope_name="test",otel_scope_version=""} 3`) {
+		t.Errorf("GET /metrics = %q, want k8s_image_pulls_total of 3", rec.Body.String())
+	}
+}
+
+func TestNewMeterProviderRejectsUnknownExporters(t *testing.T) {
+	_, _, err := newMeterProvider(context.Background(), resource.Empty(), meterProviderConfig{exporters: []string{"otlp", "statsd"}}, http.NewServeMux())
+	if err == nil || !strings.Contains(err.Error(), `unknown exporter "statsd"`) {
+		t.Errorf("newMeterProvider = %v, want an unknown exporter error", err)
+	}
+}
+
+func TestNewMeterProviderExportTimeout(t *testing.T) {
+	// the collector never responds and reports how long each request was
+	// kept open by the exporter
+	held := make(chan time.Duration, 100)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// the server notices the client going away only after the body
+		// was read
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+		held <- time.Since(start)
+	}))
+	t.Cleanup(collector.Close)
+
+	cfg := meterProviderConfig{
+		exporters:    []string{"otlp"},
+		endpoint:     collector.URL + "/v1/metrics",
+		manualReader: true,
+		timeout:      100 * time.Millisecond,
+	}
+	provider, manual, err := newMeterProvider(context.Background(), resource.Empty(), cfg, http.NewServeMux())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	counter, _ := provider.Meter("test").Int64Counter("k8s.image.pulls")
+	counter.Add(context.Background(), 1)
+
+	// the timeout bounds each request, the exporter retries until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := manual.export(ctx); err == nil {
+		t.Error("export to an unresponsive collector succeeded, want a timeout")
+	}
+	select {
+	case d := <-held:
+		if d > 500*time.Millisecond {
+			t.Errorf("first request was held open for %s, want it abandoned after the 100ms timeout", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector received no request")
+	}
+}
+
+// slowExporter is a collector taking a minute to accept each export, unless
+// the export's context is done first.
+type slowExporter struct{}
+
+func (slowExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (slowExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (slowExporter) Export(ctx context.Context, _ *metricdata.ResourceMetrics) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Minute):
+		return nil
+	}
+}
+
+func (slowExporter) ForceFlush(context.Context) error { return nil }
+
+func (slowExporter) Shutdown(context.Context) error { return nil }
+
+func TestShutdownMeterProviderTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		manual bool
+	}{
+		{name: "periodic reader"},
+		{name: "manual export", manual: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var provider *sdkmetric.MeterProvider
+			var manual *manualExport
+			if tt.manual {
+				manual = newManualExport(slowExporter{})
+				provider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(manual.reader))
+			} else {
+				provider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(slowExporter{}, sdkmetric.WithInterval(time.Hour))))
+			}
+			counter, _ := provider.Meter("test").Int64Counter("k8s.image.pulls")
+			counter.Add(context.Background(), 1)
+
+			var logs strings.Builder
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			start := time.Now()
+			shutdownMeterProvider(provider, manual, 100*time.Millisecond)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("shutdown returned after %s, want it bounded by the 100ms timeout", elapsed)
+			}
+			if !strings.Contains(logs.String(), "Final flush timed out after 100ms") {
+				t.Errorf("logged %q, want the flush to time out", logs.String())
+			}
+		})
+	}
+}
+
+// newTestProxy returns an HTTP proxy answering every request itself, and the
+// hosts it was asked to forward to.
+func newTestProxy(t *testing.T) (*url.URL, <-chan string) {
+	t.Helper()
+	hosts := make(chan string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		hosts <- r.URL.Host
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, hosts
+}
+
+// setProxyEnv sets the proxy environment variables for the test, clearing
+// their lowercase variants.
+func setProxyEnv(t *testing.T, httpProxy, noProxy string) {
+	t.Helper()
+	for _, key := range []string{"http_proxy", "https_proxy", "no_proxy", "HTTPS_PROXY"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("HTTP_PROXY", httpProxy)
+	t.Setenv("NO_PROXY", noProxy)
+}
+
+func TestOTLPProxy(t *testing.T) {
+	flagProxy, _ := url.Parse("http://flag-proxy.example:3128")
+	tests := []struct {
+		name     string
+		flag     *url.URL
+		envProxy string
+		noProxy  string
+		target   string
+		want     string
+	}{
+		{name: "flag overrides the environment", flag: flagProxy, envProxy: "http://env-proxy.example:3128", target: "http://collector.example:4318/v1/metrics", want: "http://flag-proxy.example:3128"},
+		{name: "flag ignores NO_PROXY", flag: flagProxy, noProxy: "collector.example", target: "http://collector.example:4318/v1/metrics", want: "http://flag-proxy.example:3128"},
+		{name: "environment", envProxy: "http://env-proxy.example:3128", target: "http://collector.example:4318/v1/metrics", want: "http://env-proxy.example:3128"},
+		{name: "NO_PROXY", envProxy: "http://env-proxy.example:3128", noProxy: "collector.example", target: "http://collector.example:4318/v1/metrics"},
+		{name: "no proxy", target: "http://collector.example:4318/v1/metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setProxyEnv(t, tt.envProxy, tt.noProxy)
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			got, err := otlpProxy(tt.flag)(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var proxy string
+			if got != nil {
+				proxy = got.String()
+			}
+			if proxy != tt.want {
+				t.Errorf("otlpProxy() = %q, want %q", proxy, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMeterProviderExportsThroughProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		flag bool
+	}{
+		{name: "-otlp-proxy", flag: true},
+		{name: "HTTP_PROXY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envProxy, envHosts := newTestProxy(t)
+			flagProxy, flagHosts := newTestProxy(t)
+			setProxyEnv(t, envProxy.String(), "")
+			cfg := meterProviderConfig{
+				exporters: []string{"otlp"},
+				// never resolved, as the proxy answers in its place
+				endpoint: "http://collector.example:4318/v1/metrics",
+			}
+			want, other := envHosts, flagHosts
+			if tt.flag {
+				cfg.proxy = flagProxy
+				want, other = flagHosts, envHosts
+			}
+			exportOnce(t, cfg)
+
+			select {
+			case host := <-want:
+				if host != "collector.example:4318" {
+					t.Errorf("proxy forwarded to %q, want collector.example:4318", host)
+				}
+			default:
+				t.Error("export didn't go through the proxy")
+			}
+			select {
+			case <-other:
+				t.Error("export went through the other proxy")
+			default:
+			}
+		})
+	}
+}
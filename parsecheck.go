@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s-image-pull-metrics/pullmetrics"
+)
+
+// parseCheckResult is printed for every message parsed by -parse-check.
+type parseCheckResult struct {
+	Image          string `json:"image"`
+	PullDurationMs int64  `json:"pull_duration_ms"`
+	WaitDurationMs int64  `json:"wait_duration_ms"`
+	SizeBytes      int64  `json:"size_bytes"`
+}
+
+// runParseCheck parses the Pulled event messages in the file at path, or
+// stdin for "-", one per line, with templates. It prints the parsed pull or
+// the reason parsing failed for each line and returns an error if any line
+// failed, so changes to the message templates can be checked against a
+// corpus of real messages without a cluster.
+func runParseCheck(path string, templates []pullmetrics.MessageTemplate, w io.Writer) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening -parse-check input: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var line, messages, failed int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+		msg := strings.TrimSpace(scanner.Text())
+		if msg == "" {
+			continue
+		}
+		messages++
+		info, err := pullmetrics.ParsePulledMessage(msg, templates)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL\tline %d: %s\n", line, err)
+			continue
+		}
+		result, err := json.Marshal(parseCheckResult{
+			Image:          info.Image,
+			PullDurationMs: info.PullDuration.Milliseconds(),
+			WaitDurationMs: info.WaitDuration().Milliseconds(),
+			SizeBytes:      info.Size,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "ok\t%s\n", result)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading -parse-check input: %w", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d messages failed to parse", failed, messages)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s-image-pull-metrics/pullmetrics"
+)
+
+func TestRunParseCheck(t *testing.T) {
+	custom, err := pullmetrics.ParseMessageTemplate("cri-o", `^Pulled image "(?P<image>[^"]+)" after (?P<pull>\S+)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		corpus    string
+		templates []pullmetrics.MessageTemplate
+		want      string
+		wantErr   string
+	}{
+		{
+			name: "all parse",
+			corpus: `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1000 bytes.
+
+Successfully pulled image "ghcr.io/acme/web:1.4" in 800ms (800ms including waiting)
+`,
+			want: `ok	{"image":"nginx:1.27","pull_duration_ms":1500,"wait_duration_ms":500,"size_bytes":1000}
+ok	{"image":"ghcr.io/acme/web:1.4","pull_duration_ms":800,"wait_duration_ms":0,"size_bytes":0}
+`,
+		},
+		{
+			name: "some fail",
+			corpus: `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1000 bytes.
+Pulled image "nginx:1.27" after 1.5s
+Container image "nginx:1.27" already present on machine
+`,
+			want: `ok	{"image":"nginx:1.27","pull_duration_ms":1500,"wait_duration_ms":500,"size_bytes":1000}
+FAIL	line 2: no message template matches "Pulled image \"nginx:1.27\" after 1.5s"
+FAIL	line 3: no message template matches "Container image \"nginx:1.27\" already present on machine"
+`,
+			wantErr: "2 of 3 messages failed to parse",
+		},
+		{
+			name:      "custom template",
+			corpus:    `Pulled image "nginx:1.27" after 1.5s`,
+			templates: []pullmetrics.MessageTemplate{custom},
+			want: `ok	{"image":"nginx:1.27","pull_duration_ms":1500,"wait_duration_ms":0,"size_bytes":0}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages.txt")
+			if err := os.WriteFile(path, []byte(tt.corpus), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			err := runParseCheck(path, append(tt.templates, pullmetrics.DefaultMessageTemplates...), &out)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("runParseCheck() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("runParseCheck() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("runParseCheck() printed\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunParseCheckMissingFile(t *testing.T) {
+	err := runParseCheck(filepath.Join(t.TempDir(), "missing.txt"), pullmetrics.DefaultMessageTemplates, &strings.Builder{})
+	if err == nil || !strings.Contains(err.Error(), "opening -parse-check input") {
+		t.Errorf("runParseCheck() error = %v, want an opening error", err)
+	}
+}
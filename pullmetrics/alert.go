@@ -0,0 +1,114 @@
+package pullmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// pullAlert is the JSON payload POSTed to the alert webhook.
+type pullAlert struct {
+	Time           time.Time `json:"time"`
+	Cluster        string    `json:"cluster,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Pod            string    `json:"pod"`
+	Node           string    `json:"node"`
+	Image          string    `json:"image"`
+	PullDurationMs int64     `json:"pull_duration_ms"`
+	ThresholdMs    int64     `json:"threshold_ms"`
+}
+
+// alerter POSTs an alert to a webhook for pulls slower than a threshold,
+// e.g. stuck pulls on-call should know about right away. Each node alerts
+// at most once per interval so a struggling registry can't cause a storm,
+// and alerts are posted on a separate goroutine behind a bounded queue.
+type alerter struct {
+	webhook   string
+	threshold time.Duration
+	client    *http.Client
+	queue     chan pullAlert
+	// alerted holds the nodes that alerted within the interval
+	alerted *ttlMap[string, struct{}]
+}
+
+func newAlerter(webhook string, threshold, interval time.Duration, maxEntries int) (*alerter, error) {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid alert webhook %q, expected an http(s) URL", webhook)
+	}
+	a := &alerter{
+		webhook:   webhook,
+		threshold: threshold,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queue:     make(chan pullAlert, 100),
+		alerted:   newTTLMap[string, struct{}]("alerted_nodes", interval, maxEntries),
+	}
+	go a.run()
+	return a, nil
+}
+
+// check queues an alert if the pull took longer than the threshold and its
+// node didn't alert within the interval.
+func (a *alerter) check(event *v1.Event, info PullInfo, cluster string) {
+	if info.PullDuration <= a.threshold {
+		return
+	}
+	node := eventHost(event)
+	limited := false
+	a.alerted.update(node, func(_ struct{}, found bool) struct{} {
+		limited = found
+		return struct{}{}
+	})
+	if limited {
+		log.Println("Not alerting on slow pull of", info.Image, "on", node, "again within the alert interval")
+		return
+	}
+
+	alert := pullAlert{
+		Time:           eventTime(event),
+		Cluster:        cluster,
+		Namespace:      event.Namespace,
+		Pod:            event.InvolvedObject.Name,
+		Node:           node,
+		Image:          info.Image,
+		PullDurationMs: info.PullDuration.Milliseconds(),
+		ThresholdMs:    a.threshold.Milliseconds(),
+	}
+	select {
+	case a.queue <- alert:
+	default:
+		log.Println("Alert queue full, dropping alert for", info.Image)
+	}
+}
+
+func (a *alerter) run() {
+	for alert := range a.queue {
+		if err := a.post(alert); err != nil {
+			log.Println("Failed to post alert:", err)
+		}
+	}
+}
+
+func (a *alerter) post(alert pullAlert) error {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned %s", resp.Status)
+	}
+	return nil
+}
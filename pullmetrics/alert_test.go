@@ -0,0 +1,73 @@
+package pullmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestAlerts(t *testing.T) {
+	alerts := make(chan pullAlert, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert pullAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("decoding alert: %v", err)
+		}
+		alerts <- alert
+	}))
+	t.Cleanup(webhook.Close)
+
+	h, _ := newTestHandler(t, WithAlerts(webhook.URL, 10*time.Second, time.Hour), WithClusterName("prod"))
+	pulls := []struct {
+		node     string
+		pod      string
+		duration time.Duration
+	}{
+		{"node-1", "web-1", 5 * time.Second},
+		{"node-1", "web-2", 10 * time.Second},
+		{"node-1", "web-3", 30 * time.Second},
+		// rate limited
+		{"node-1", "web-4", 40 * time.Second},
+		{"node-2", "web-5", time.Minute},
+	}
+	for _, p := range pulls {
+		event := podEvent("", p.pod, "Pulled", pulledMessage("nginx:1.27", p.duration, 1000))
+		event.Source.Host = p.node
+		h.OnEvent(context.Background(), event)
+	}
+
+	want := []pullAlert{
+		{Cluster: "prod", Namespace: "default", Pod: "web-3", Node: "node-1", Image: "nginx:1.27", PullDurationMs: 30000, ThresholdMs: 10000},
+		{Cluster: "prod", Namespace: "default", Pod: "web-5", Node: "node-2", Image: "nginx:1.27", PullDurationMs: 60000, ThresholdMs: 10000},
+	}
+	for _, w := range want {
+		select {
+		case got := <-alerts:
+			got.Time = time.Time{}
+			if got != w {
+				t.Errorf("alert = %+v, want %+v", got, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no alert for %s", w.Pod)
+		}
+	}
+	select {
+	case got := <-alerts:
+		t.Errorf("unexpected alert %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAlertsRejectInvalidWebhooks(t *testing.T) {
+	meter := sdkmetric.NewMeterProvider().Meter("test")
+	for _, webhook := range []string{"alerts.example.com/hook", "ftp://alerts.example.com", "http://[::1"} {
+		if _, err := New(meter, WithAlerts(webhook, time.Second, time.Minute)); err == nil {
+			t.Errorf("New with webhook %q succeeded, want error", webhook)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package pullmetrics
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// attrKey returns the attribute key for name under the attribute prefix,
+// which namespaces the attributes describing the pulled image and the pod it
+// was pulled for.
+func (h *Handler) attrKey(name string) attribute.Key {
+	return attribute.Key(h.opts().attributePrefix + name)
+}
+
+// clusterAttributes returns the k8s.cluster.name attribute if a cluster name
+// is configured.
+func (h *Handler) clusterAttributes() []attribute.KeyValue {
+	if h.opts().clusterName == "" {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.String("k8s.cluster.name", h.opts().clusterName)}
+}
+
+// clusterOption adds the cluster attributes to a measurement. Attributes of
+// several options are merged.
+func (h *Handler) clusterOption() metric.MeasurementOption {
+	return metric.WithAttributes(h.clusterAttributes()...)
+}
@@ -0,0 +1,54 @@
+package pullmetrics
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttributePrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		prefix string
+	}{
+		{name: "default", prefix: "exported."},
+		{name: "custom", opts: []Option{WithAttributePrefix("k8s.")}, prefix: "k8s."},
+		{name: "empty", opts: []Option{WithAttributePrefix("")}, prefix: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, tt.opts...)
+			h.OnEvent(context.Background(), podEvent("", "web-5d8f7c9b4-x2x7k", "Pulled", pulledMessage("nginx:1.27", 2*time.Second, 1000)))
+
+			durations := collect(t, reader, "k8s.image.pull.duration")
+			if len(durations) != 1 {
+				t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(durations))
+			}
+			for key, want := range map[string]string{
+				"namespace":     "default",
+				"pod.image":     "nginx:1.27",
+				"host":          "node-1",
+				"pod.prefix":    "web",
+				"image.retried": "false",
+			} {
+				if got := attributeValue(durations[0].attributes, tt.prefix+key); got != want {
+					t.Errorf("%s = %q, want %q", tt.prefix+key, got, want)
+				}
+			}
+			// attributes that don't describe the pod or image keep their names
+			var keys []string
+			for _, kv := range durations[0].attributes.ToSlice() {
+				keys = append(keys, string(kv.Key))
+			}
+			if !slices.Contains(keys, "observed.timestamp") {
+				t.Errorf("attributes %v lack observed.timestamp", keys)
+			}
+			if tt.prefix != "exported." && slices.ContainsFunc(keys, func(k string) bool { return strings.HasPrefix(k, "exported.") }) {
+				t.Errorf("attributes %v still use the default prefix", keys)
+			}
+		})
+	}
+}
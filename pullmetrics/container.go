@@ -0,0 +1,70 @@
+package pullmetrics
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// containerFieldPaths maps the field path prefix kubelet sets on a pod
+// event's involved object to the type of container the event is about.
+var containerFieldPaths = []struct {
+	prefix        string
+	containerType string
+}{
+	{"spec.initContainers{", "init"},
+	{"spec.containers{", "regular"},
+	{"spec.ephemeralContainers{", "ephemeral"},
+}
+
+// parseContainerFieldPath splits a field path such as
+// "spec.initContainers{setup}" into the container type ("init", "regular"
+// or "ephemeral") and the container name. It returns false for field paths
+// that don't refer to a container.
+func parseContainerFieldPath(fieldPath string) (containerType, name string, ok bool) {
+	for _, p := range containerFieldPaths {
+		if rest, found := strings.CutPrefix(fieldPath, p.prefix); found && strings.HasSuffix(rest, "}") {
+			return p.containerType, strings.TrimSuffix(rest, "}"), true
+		}
+	}
+	return "", "", false
+}
+
+// specImagePinned reports whether the pod spec pins the image of the given
+// container by digest, which can differ from the reference kubelet reports
+// pulling. It returns false for ok if the pod or container can't be found.
+func (h *Handler) specImagePinned(namespace, podName, containerType, containerName string) (pinned, ok bool) {
+	pod, ok := h.lookups.getPod(namespace, podName)
+	if !ok {
+		return false, false
+	}
+
+	var image string
+	ok = false
+	switch containerType {
+	case "init":
+		image, ok = containerImage(pod.Spec.InitContainers, containerName)
+	case "regular":
+		image, ok = containerImage(pod.Spec.Containers, containerName)
+	case "ephemeral":
+		for _, c := range pod.Spec.EphemeralContainers {
+			if c.Name == containerName {
+				image, ok = c.Image, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return false, false
+	}
+	return parseImageRef(image).pinned(), true
+}
+
+func containerImage(containers []v1.Container, name string) (string, bool) {
+	for _, c := range containers {
+		if c.Name == name {
+			return c.Image, true
+		}
+	}
+	return "", false
+}
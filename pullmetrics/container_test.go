@@ -0,0 +1,103 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseContainerFieldPath(t *testing.T) {
+	tests := []struct {
+		fieldPath string
+		wantType  string
+		wantName  string
+		wantOK    bool
+	}{
+		{fieldPath: "spec.initContainers{setup}", wantType: "init", wantName: "setup", wantOK: true},
+		{fieldPath: "spec.containers{web}", wantType: "regular", wantName: "web", wantOK: true},
+		{fieldPath: "spec.ephemeralContainers{debugger-x7k2p}", wantType: "ephemeral", wantName: "debugger-x7k2p", wantOK: true},
+		{fieldPath: "spec.containers{}", wantType: "regular", wantName: "", wantOK: true},
+		{fieldPath: "spec.volumes{data}"},
+		{fieldPath: "spec.containers{web"},
+		{fieldPath: "spec"},
+		{fieldPath: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fieldPath, func(t *testing.T) {
+			containerType, name, ok := parseContainerFieldPath(tt.fieldPath)
+			if containerType != tt.wantType || name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("parseContainerFieldPath(%q) = %q, %q, %v, want %q, %q, %v", tt.fieldPath, containerType, name, ok, tt.wantType, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSpecImagePinned(t *testing.T) {
+	const digest = "@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: metav1.NamespaceDefault},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "setup", Image: "busybox:1.36" + digest}},
+			Containers:     []v1.Container{{Name: "web", Image: "nginx:1.27"}, {Name: "sidecar", Image: "envoy" + digest}},
+			EphemeralContainers: []v1.EphemeralContainer{
+				{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "debug", Image: "busybox" + digest}},
+				{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "shell", Image: "busybox:1.36"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		pod, containerType, container string
+		wantPinned, wantOK            bool
+	}{
+		{"web-1", "regular", "web", false, true},
+		{"web-1", "regular", "sidecar", true, true},
+		{"web-1", "init", "setup", true, true},
+		{"web-1", "ephemeral", "debug", true, true},
+		{"web-1", "ephemeral", "shell", false, true},
+		{"web-1", "regular", "missing", false, false},
+		{"web-1", "init", "web", false, false},
+		{"web-1", "ephemeral", "missing", false, false},
+		{"web-1", "unknown", "web", false, false},
+		{"web-2", "regular", "web", false, false},
+	}
+	h, _ := newTestHandler(t, withFakeLookups(pod))
+	for _, tt := range tests {
+		pinned, ok := h.specImagePinned(metav1.NamespaceDefault, tt.pod, tt.containerType, tt.container)
+		if pinned != tt.wantPinned || ok != tt.wantOK {
+			t.Errorf("specImagePinned(%s, %s, %s) = %v, %v, want %v, %v", tt.pod, tt.containerType, tt.container, pinned, ok, tt.wantPinned, tt.wantOK)
+		}
+	}
+}
+
+func TestSpecImagePinnedAttribute(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: metav1.NamespaceDefault},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web", Image: "nginx:1.27"}}},
+	}
+	tests := []struct {
+		fieldPath string
+		want      string
+	}{
+		{"spec.containers{web}", "false"},
+		// left out when the container can't be found
+		{"spec.ephemeralContainers{debug}", ""},
+	}
+	for _, tt := range tests {
+		h, reader := newTestHandler(t, withFakeLookups(pod))
+		event := podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", 2*time.Second, 1000))
+		event.InvolvedObject.FieldPath = tt.fieldPath
+		h.OnEvent(context.Background(), event)
+
+		durations := collect(t, reader, "k8s.image.pull.duration")
+		if len(durations) != 1 {
+			t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(durations))
+		}
+		if got := attributeValue(durations[0].attributes, "exported.spec.image_pinned"); got != tt.want {
+			t.Errorf("exported.spec.image_pinned for %s = %q, want %q", tt.fieldPath, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pullmetrics
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// extracts the quoted image reference from messages such as
+// `Failed to pull image "nginx:nope": rpc error: ...`,
+// `Back-off pulling image "nginx:nope"` and `Pulling image "nginx:latest"`
+var failedImageRe = regexp.MustCompile(`image "([^"]+)"`)
+
+func pullKey(event *v1.Event, image string) string {
+	return event.Namespace + "/" + event.InvolvedObject.Name + "/" + image
+}
+
+// pullErrorClasses maps substrings of kubelet pull failure messages to a
+// normalized failure reason. The first match wins, so more specific patterns
+// come first.
+var pullErrorClasses = []struct {
+	reason   string
+	patterns []string
+}{
+	{"backoff", []string{"Back-off pulling image", "ImagePullBackOff"}},
+	{"invalid_name", []string{"InvalidImageName", "invalid reference format"}},
+	{"auth", []string{"unauthorized", "authentication required", "no basic auth credentials", "access denied", "denied:", "403 Forbidden", "401 Unauthorized"}},
+	{"not_found", []string{"manifest unknown", "not found", "NotFound", "repository does not exist"}},
+	{"rate_limited", []string{"toomanyrequests", "429 Too Many Requests", "rate limit"}},
+	{"registry_unavailable", []string{"i/o timeout", "deadline exceeded", "connection refused", "connection reset", "no such host", "TLS handshake timeout", "503 Service Unavailable", "502 Bad Gateway", "EOF"}},
+	{"no_space", []string{"no space left on device"}},
+}
+
+// classifyPullError normalizes a kubelet image pull failure message into a
+// small set of reasons suitable for alerting: backoff, invalid_name, auth,
+// not_found, rate_limited, registry_unavailable, no_space or unknown.
+func classifyPullError(msg string) string {
+	lower := strings.ToLower(msg)
+	for _, class := range pullErrorClasses {
+		for _, pattern := range class.patterns {
+			if strings.Contains(lower, strings.ToLower(pattern)) {
+				return class.reason
+			}
+		}
+	}
+	return "unknown"
+}
+
+// recordPullFailure counts a Failed or BackOff event by its failure reason
+// and remembers it for the pod and image it refers to. Failed events
+// unrelated to image pulls are ignored.
+func (h *Handler) recordPullFailure(ctx context.Context, event *v1.Event) {
+	msg := event.Message
+	if event.Reason == "Failed" && !strings.HasPrefix(msg, "Failed to pull image") {
+		return
+	}
+	if event.Reason == "BackOff" && !strings.HasPrefix(msg, "Back-off pulling image") {
+		return
+	}
+
+	matches := failedImageRe.FindStringSubmatch(msg)
+	if len(matches) < 2 {
+		log.Println("Failed to extract image from event message:", msg)
+		return
+	}
+
+	image := matches[1]
+	if !h.registryAllowed(parseImageRef(image).registry) {
+		return
+	}
+
+	attributes := metric.WithAttributes(
+		h.attrKey("namespace").String(event.Namespace),
+		h.attrKey("pod.image").String(image),
+		h.attrKey("host").String(eventHost(event)),
+		h.attrKey("failure.reason").String(classifyPullError(msg)),
+	)
+	h.record(ctx, func(ctx context.Context) {
+		h.pullFailureCounter.Add(ctx, 1, attributes, h.clusterOption())
+	})
+
+	if event.Reason == "Failed" {
+		h.finishPull(ctx, event, image)
+	}
+
+	h.pullFailures.update(pullKey(event, image), func(count int64, _ bool) int64 {
+		return count + 1
+	})
+}
+
+// takePullFailures returns how many failures were seen for the pod and image
+// before it was pulled successfully, and forgets them.
+func (h *Handler) takePullFailures(event *v1.Event, image string) int64 {
+	count, _ := h.pullFailures.delete(pullKey(event, image))
+	return count
+}
+
+// priorFailuresBucket buckets the failures before a successful pull to bound
+// the cardinality of the attribute recording them.
+func priorFailuresBucket(count int64) string {
+	switch {
+	case count <= 1:
+		return strconv.FormatInt(count, 10)
+	case count <= 5:
+		return "2-5"
+	default:
+		return "6+"
+	}
+}
@@ -0,0 +1,159 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetriedPull(t *testing.T) {
+	const image = "registry.example.com/web:1.0"
+	failed := `Failed to pull image "` + image + `": rpc error: code = Unknown desc = 429 Too Many Requests`
+	backOff := `Back-off pulling image "` + image + `"`
+	pulled := pulledMessage(image, 2*time.Second, 1000)
+
+	type event struct{ pod, reason, message string }
+	tests := []struct {
+		name         string
+		events       []event
+		wantRetried  string
+		wantFailures string
+	}{
+		{
+			name:         "pulled at first",
+			events:       []event{{"web-1", "Pulled", pulled}},
+			wantRetried:  "false",
+			wantFailures: "0",
+		},
+		{
+			name:         "failed and backed off before",
+			events:       []event{{"web-1", "Failed", failed}, {"web-1", "BackOff", backOff}, {"web-1", "Failed", failed}, {"web-1", "Pulled", pulled}},
+			wantRetried:  "true",
+			wantFailures: "2-5",
+		},
+		{
+			name:         "failed once before",
+			events:       []event{{"web-1", "Failed", failed}, {"web-1", "Pulled", pulled}},
+			wantRetried:  "true",
+			wantFailures: "1",
+		},
+		{
+			name:         "failures of another pod",
+			events:       []event{{"web-2", "Failed", failed}, {"web-1", "Pulled", pulled}},
+			wantRetried:  "false",
+			wantFailures: "0",
+		},
+		{
+			name:         "failures of another image",
+			events:       []event{{"web-1", "Failed", `Failed to pull image "registry.example.com/db:1.0": not found`}, {"web-1", "Pulled", pulled}},
+			wantRetried:  "false",
+			wantFailures: "0",
+		},
+		{
+			name:         "failed events unrelated to pulls",
+			events:       []event{{"web-1", "Failed", "Error: ErrImagePull"}, {"web-1", "Pulled", pulled}},
+			wantRetried:  "false",
+			wantFailures: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t)
+			for _, e := range tt.events {
+				h.OnEvent(context.Background(), podEvent("", e.pod, e.reason, e.message))
+			}
+			durations := collect(t, reader, "k8s.image.pull.duration")
+			if len(durations) != 1 {
+				t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(durations))
+			}
+			if got := attributeValue(durations[0].attributes, "exported.image.retried"); got != tt.wantRetried {
+				t.Errorf("exported.image.retried = %q, want %q", got, tt.wantRetried)
+			}
+			if got := attributeValue(durations[0].attributes, "exported.image.prior_failures"); got != tt.wantFailures {
+				t.Errorf("exported.image.prior_failures = %q, want %q", got, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestRetriedPullForgetsFailures(t *testing.T) {
+	const image = "registry.example.com/web:1.0"
+	h, reader := newTestHandler(t)
+	h.OnEvent(context.Background(), podEvent("", "web-1", "Failed", `Failed to pull image "`+image+`": i/o timeout`))
+	h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)))
+	h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage(image, 3*time.Second, 1000)))
+
+	retried := map[string]float64{}
+	for _, p := range collect(t, reader, "k8s.image.pull.duration") {
+		retried[attributeValue(p.attributes, "exported.image.retried")] += p.value
+	}
+	if retried["true"] != 1 || retried["false"] != 1 {
+		t.Errorf("pulls by exported.image.retried = %v, want one retried and one not", retried)
+	}
+}
+
+func TestPriorFailuresBucket(t *testing.T) {
+	tests := []struct {
+		count int64
+		want  string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{2, "2-5"},
+		{5, "2-5"},
+		{6, "6+"},
+		{100, "6+"},
+	}
+	for _, tt := range tests {
+		if got := priorFailuresBucket(tt.count); got != tt.want {
+			t.Errorf("priorFailuresBucket(%d) = %q, want %q", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyPullError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{`Back-off pulling image "nginx:nope"`, "backoff"},
+		{`Failed to pull image "Nginx": InvalidImageName`, "invalid_name"},
+		{`Failed to pull image "nginx:1.27": rpc error: code = Unknown desc = failed to resolve reference: unexpected status from HEAD request: 401 Unauthorized`, "auth"},
+		{`Failed to pull image "123456789012.dkr.ecr.us-east-1.amazonaws.com/app:1": no basic auth credentials`, "auth"},
+		{`Failed to pull image "nginx:nope": rpc error: code = NotFound desc = failed to resolve reference "docker.io/library/nginx:nope": not found`, "not_found"},
+		{`Failed to pull image "nginx:1.27": toomanyrequests: You have reached your pull rate limit`, "rate_limited"},
+		{`Failed to pull image "registry.example.com/app:1": dial tcp 10.0.0.1:443: i/o timeout`, "registry_unavailable"},
+		{`Failed to pull image "registry.example.com/app:1": write /var/lib/containerd/tmp: no space left on device`, "no_space"},
+		// matched case-insensitively
+		{`Failed to pull image "nginx:1.27": TOOMANYREQUESTS`, "rate_limited"},
+		// the first matching class wins
+		{`Back-off pulling image "nginx:nope": not found`, "backoff"},
+		{`Failed to pull image "nginx:1.27": something else`, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := classifyPullError(tt.msg); got != tt.want {
+			t.Errorf("classifyPullError(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestPullFailureCounter(t *testing.T) {
+	h, reader := newTestHandler(t)
+	for _, e := range []struct{ reason, message string }{
+		{"Failed", `Failed to pull image "nginx:1.27": toomanyrequests`},
+		{"Failed", `Failed to pull image "nginx:1.27": 429 Too Many Requests`},
+		{"BackOff", `Back-off pulling image "nginx:1.27"`},
+		// not about a pull
+		{"Failed", `Error: ImagePullBackOff`},
+	} {
+		h.OnEvent(context.Background(), podEvent("", "web-1", e.reason, e.message))
+	}
+
+	got := map[string]float64{}
+	for _, p := range collect(t, reader, "k8s.image.pull.failures") {
+		got[attributeValue(p.attributes, "exported.failure.reason")] += p.value
+	}
+	if len(got) != 2 || got["rate_limited"] != 2 || got["backoff"] != 1 {
+		t.Errorf("k8s.image.pull.failures by reason = %v, want 2 rate_limited and 1 backoff", got)
+	}
+}
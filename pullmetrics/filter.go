@@ -0,0 +1,108 @@
+package pullmetrics
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// registryAllowed reports whether pulls from registry should be recorded: it
+// must be in the allow-list, if set, and not in the deny-list. Images
+// without a registry host are pulled from Docker Hub and match "docker.io".
+func (h *Handler) registryAllowed(registry string) bool {
+	registry = normalizeRegistry(registry)
+	if len(h.opts().registryAllowlist) > 0 && !slices.Contains(h.opts().registryAllowlist, registry) {
+		return false
+	}
+	return !slices.Contains(h.opts().registryDenylist, registry)
+}
+
+// normalizeRegistry lowercases registry and maps Docker Hub's aliases to
+// "docker.io".
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(registry)
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return registry
+}
+
+func normalizeRegistries(registries []string) []string {
+	normalized := make([]string, len(registries))
+	for i, r := range registries {
+		normalized[i] = normalizeRegistry(strings.TrimSpace(r))
+	}
+	return normalized
+}
+
+// fromSourceComponent reports whether event was emitted by the configured
+// source component. Some managed distributions report the component
+// differently cased or with a suffix (e.g. "Kubelet" or "kubelet-eks"), and
+// newer clients only fill in ReportingController, so either field may match,
+// case-insensitively and by prefix.
+func (h *Handler) fromSourceComponent(event *v1.Event) bool {
+	want := strings.ToLower(h.opts().sourceComponent)
+	for _, component := range []string{event.Source.Component, event.ReportingController} {
+		if component != "" && strings.HasPrefix(strings.ToLower(component), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventTime returns when event was last observed, falling back to EventTime
+// for events that don't set LastTimestamp.
+func eventTime(event *v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
+
+// eventSpan returns the time between the first and last occurrence of an
+// event kubelet coalesced, or false if it occurred only once.
+func eventSpan(event *v1.Event) (time.Duration, bool) {
+	if event.Count <= 1 || event.FirstTimestamp.IsZero() || event.LastTimestamp.IsZero() {
+		return 0, false
+	}
+	return max(event.LastTimestamp.Sub(event.FirstTimestamp.Time), 0), true
+}
+
+// eventCountBucket buckets the occurrences of a coalesced event to bound the
+// cardinality of the attribute recording it.
+func eventCountBucket(count int32) string {
+	switch {
+	case count <= 2:
+		return "2"
+	case count <= 5:
+		return "3-5"
+	case count <= 10:
+		return "6-10"
+	case count <= 50:
+		return "11-50"
+	default:
+		return "51+"
+	}
+}
+
+// tooOld reports whether event is older than the maximum event age, e.g. one
+// replayed by the informer's initial list long after the pull happened.
+func (h *Handler) tooOld(event *v1.Event) bool {
+	if h.opts().maxEventAge <= 0 {
+		return false
+	}
+	t := eventTime(event)
+	return !t.IsZero() && time.Since(t) > h.opts().maxEventAge
+}
+
+// eventHost returns the node that emitted event, preferring Source.Host and
+// falling back to ReportingInstance for events that only set the latter.
+func eventHost(event *v1.Event) string {
+	if event.Source.Host != "" {
+		return event.Source.Host
+	}
+	return event.ReportingInstance
+}
@@ -0,0 +1,163 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRegistryFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		denylist  []string
+		image     string
+		want      bool
+	}{
+		{name: "no lists", image: "registry.k8s.io/pause:3.9", want: true},
+		{name: "allowed", allowlist: []string{"registry.example.com"}, image: "registry.example.com/app:1", want: true},
+		{name: "not allowed", allowlist: []string{"registry.example.com"}, image: "ghcr.io/org/app:1", want: false},
+		{name: "denied", denylist: []string{"registry.k8s.io"}, image: "registry.k8s.io/pause:3.9", want: false},
+		{name: "not denied", denylist: []string{"registry.k8s.io"}, image: "registry.example.com/app:1", want: true},
+		{name: "denied wins over allowed", allowlist: []string{"registry.k8s.io"}, denylist: []string{"registry.k8s.io"}, image: "registry.k8s.io/pause:3.9", want: false},
+		{name: "docker hub without registry", allowlist: []string{"docker.io"}, image: "nginx:1.27", want: true},
+		{name: "docker hub alias", denylist: []string{"docker.io"}, image: "index.docker.io/library/nginx:1.27", want: false},
+		{name: "list entries normalized", allowlist: []string{" Registry-1.Docker.io "}, image: "bitnami/redis:7.2", want: true},
+		{name: "registry case", allowlist: []string{"registry.example.com"}, image: "Registry.Example.com/app:1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithRegistryFilter(tt.allowlist, tt.denylist))
+			if got := h.registryAllowed(parseImageRef(tt.image).registry); got != tt.want {
+				t.Errorf("registryAllowed(%q) = %v, want %v", tt.image, got, tt.want)
+			}
+
+			// filtered images are left out of the pull and failure metrics
+			ctx := context.Background()
+			h.OnEvent(ctx, podEvent("", "web-1", "Failed", `Failed to pull image "`+tt.image+`": i/o timeout`))
+			h.OnEvent(ctx, podEvent("", "web-1", "Pulled", pulledMessage(tt.image, 2*time.Second, 1000)))
+			want := 0
+			if tt.want {
+				want = 1
+			}
+			for _, name := range []string{"k8s.image.pulls", "k8s.image.pull.failures", "k8s.image.pull.duration"} {
+				if got := sum(collect(t, reader, name)); got != float64(want) {
+					t.Errorf("%s = %v, want %d", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFromSourceComponent(t *testing.T) {
+	tests := []struct {
+		name                string
+		configured          string
+		component           string
+		reportingController string
+		want                bool
+	}{
+		{name: "exact", configured: "kubelet", component: "kubelet", want: true},
+		{name: "differently cased", configured: "kubelet", component: "Kubelet", want: true},
+		{name: "suffixed", configured: "kubelet", component: "kubelet-foo", want: true},
+		{name: "configured cased", configured: "Kubelet", component: "kubelet", want: true},
+		{name: "reporting controller only", configured: "kubelet", reportingController: "kubelet", want: true},
+		{name: "reporting controller after other source", configured: "kubelet", component: "default-scheduler", reportingController: "Kubelet-EKS", want: true},
+		{name: "other component", configured: "kubelet", component: "default-scheduler", reportingController: "default-scheduler", want: false},
+		{name: "prefix only", configured: "kubelet", component: "kube", want: false},
+		{name: "neither set", configured: "kubelet", want: false},
+		{name: "custom component", configured: "virtual-kubelet", component: "virtual-kubelet-aci", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, WithSourceComponent(tt.configured))
+			event := podEvent("", "web-1", "Pulled", "")
+			event.Source.Component = tt.component
+			event.ReportingController = tt.reportingController
+			if got := h.fromSourceComponent(event); got != tt.want {
+				t.Errorf("fromSourceComponent(%q, %q) = %v, want %v", tt.component, tt.reportingController, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxEventAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		age     time.Duration
+		useTime bool
+		want    float64
+	}{
+		{name: "recent", maxAge: time.Hour, age: time.Minute, want: 1},
+		{name: "old", maxAge: time.Hour, age: 2 * time.Hour},
+		{name: "old event time", maxAge: time.Hour, age: 2 * time.Hour, useTime: true},
+		{name: "recent event time", maxAge: time.Hour, age: time.Minute, useTime: true, want: 1},
+		{name: "disabled", age: 24 * time.Hour, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithMaxEventAge(tt.maxAge))
+			event := podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000))
+			observed := metav1.NewTime(time.Now().Add(-tt.age))
+			event.FirstTimestamp, event.LastTimestamp = observed, observed
+			if tt.useTime {
+				// events.k8s.io events only set the event time
+				event.FirstTimestamp, event.LastTimestamp = metav1.Time{}, metav1.Time{}
+				event.EventTime = metav1.NewMicroTime(observed.Time)
+			}
+			h.OnEvent(context.Background(), event)
+
+			if got := sum(collect(t, reader, "k8s.image.pulls")); got != tt.want {
+				t.Errorf("k8s.image.pulls = %v, want %v", got, tt.want)
+			}
+			if got := sum(collect(t, reader, "k8s.image.pull.events_by_reason")); got != tt.want {
+				t.Errorf("k8s.image.pull.events_by_reason = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		count      int32
+		span       time.Duration
+		wantBucket string
+	}{
+		{name: "single", count: 1},
+		{name: "coalesced", count: 4, span: 90 * time.Second, wantBucket: "3-5"},
+		{name: "coalesced twice", count: 2, span: time.Second, wantBucket: "2"},
+		{name: "many", count: 120, span: time.Hour, wantBucket: "51+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t)
+			event := podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000))
+			now := time.Now()
+			event.FirstTimestamp = metav1.NewTime(now.Add(-tt.span))
+			event.LastTimestamp = metav1.NewTime(now)
+			event.Count = tt.count
+			h.OnEvent(context.Background(), event)
+
+			points := collect(t, reader, "k8s.image.pull.event_span")
+			if tt.wantBucket == "" {
+				if len(points) != 0 {
+					t.Fatalf("k8s.image.pull.event_span = %v, want no data", points)
+				}
+				return
+			}
+			if len(points) != 1 {
+				t.Fatalf("k8s.image.pull.event_span has %d data points, want 1", len(points))
+			}
+			if got, want := points[0].value, float64(tt.span.Milliseconds()); got != want {
+				t.Errorf("k8s.image.pull.event_span = %v, want %v", got, want)
+			}
+			if got := attributeValue(points[0].attributes, "event.count"); got != tt.wantBucket {
+				t.Errorf("event.count = %q, want %q", got, tt.wantBucket)
+			}
+		})
+	}
+}
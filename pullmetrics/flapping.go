@@ -0,0 +1,34 @@
+package pullmetrics
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type pullWindow struct {
+	start time.Time
+	count int
+}
+
+// isFlapping counts a pull for the event's pod and reports whether the pod
+// exceeded the flap threshold in the current window, e.g. because it's
+// crashlooping and re-pulling its image, so a single pod can't dominate the
+// recorded series. A threshold of zero disables the limit.
+func (h *Handler) isFlapping(event *v1.Event) bool {
+	if h.opts().flapThreshold <= 0 {
+		return false
+	}
+
+	var count int
+	now := time.Now()
+	h.podPulls.update(event.Namespace+"/"+event.InvolvedObject.Name, func(w pullWindow, found bool) pullWindow {
+		if !found || now.Sub(w.start) > h.opts().flapWindow {
+			w = pullWindow{start: now}
+		}
+		w.count++
+		count = w.count
+		return w
+	})
+	return count > h.opts().flapThreshold
+}
@@ -0,0 +1,48 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlapping(t *testing.T) {
+	const window = 100 * time.Millisecond
+	tests := []struct {
+		name         string
+		pods         []string
+		sleep        bool
+		wantRecorded float64
+		wantFlapping float64
+	}{
+		{name: "within the threshold", pods: []string{"web-1", "web-1", "web-1"}, wantRecorded: 3},
+		{name: "over the threshold", pods: []string{"web-1", "web-1", "web-1", "web-1", "web-1"}, wantRecorded: 3, wantFlapping: 2},
+		{name: "counted per pod", pods: []string{"web-1", "web-2", "web-1", "web-2", "web-1", "web-2"}, wantRecorded: 6},
+		{name: "new window", pods: []string{"web-1", "web-1", "web-1", "web-1"}, sleep: true, wantRecorded: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithFlapThreshold(3, window))
+			for i, pod := range tt.pods {
+				if tt.sleep && i == len(tt.pods)-1 {
+					time.Sleep(2 * window)
+				}
+				h.OnEvent(context.Background(), podEvent("", pod, "Pulled", pulledMessage("nginx:1.27", time.Duration(i+1)*time.Second, 1000)))
+			}
+
+			if got := sum(collect(t, reader, "k8s.image.pull.duration")); got != tt.wantRecorded {
+				t.Errorf("k8s.image.pull.duration count = %v, want %v", got, tt.wantRecorded)
+			}
+			if got := sum(collect(t, reader, "k8s.image.pull.flapping")); got != tt.wantFlapping {
+				t.Errorf("k8s.image.pull.flapping = %v, want %v", got, tt.wantFlapping)
+			}
+			// flapping pulls are still counted and their bytes summed
+			if got := sum(collect(t, reader, "k8s.image.pulls")); got != float64(len(tt.pods)) {
+				t.Errorf("k8s.image.pulls = %v, want %d", got, len(tt.pods))
+			}
+			if got := sum(collect(t, reader, "k8s.image.bytes_pulled_total")); got != float64(1000*len(tt.pods)) {
+				t.Errorf("k8s.image.bytes_pulled_total = %v, want %d", got, 1000*len(tt.pods))
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package pullmetrics
+
+import "strings"
+
+// imageRef is a container image reference split into its parts, e.g.
+// "registry.example.com/team/app:1.2@sha256:abc" has registry
+// "registry.example.com", repository "team/app", tag "1.2" and digest
+// "sha256:abc".
+type imageRef struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// pinned reports whether the reference pins the image by digest, making it
+// immutable regardless of the tag.
+func (r imageRef) pinned() bool {
+	return r.digest != ""
+}
+
+// parseImageRef splits an image reference as reported by kubelet. References
+// without a registry host refer to Docker Hub, where single-component names
+// live under "library/". Digest-only references have an empty tag.
+func parseImageRef(ref string) imageRef {
+	var r imageRef
+
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.digest = name[:i], name[i+1:]
+	}
+	// a colon after the last slash separates the tag, any earlier one
+	// belongs to the registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.tag = name[:i], name[i+1:]
+	}
+
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		r.registry, r.repository = first, rest
+	} else {
+		r.registry, r.repository = "docker.io", name
+		if !found {
+			r.repository = "library/" + name
+		}
+	}
+	return r
+}
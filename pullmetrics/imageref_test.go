@@ -0,0 +1,33 @@
+package pullmetrics
+
+import "testing"
+
+func TestParseImageRef(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		ref        string
+		want       imageRef
+		wantPinned bool
+	}{
+		{"nginx", imageRef{registry: "docker.io", repository: "library/nginx"}, false},
+		{"nginx:1.27", imageRef{registry: "docker.io", repository: "library/nginx", tag: "1.27"}, false},
+		{"bitnami/redis:7.2", imageRef{registry: "docker.io", repository: "bitnami/redis", tag: "7.2"}, false},
+		{"registry.example.com/team/app:1.2", imageRef{registry: "registry.example.com", repository: "team/app", tag: "1.2"}, false},
+		{"registry.example.com:5000/app", imageRef{registry: "registry.example.com:5000", repository: "app"}, false},
+		{"registry.example.com:5000/app:1.2", imageRef{registry: "registry.example.com:5000", repository: "app", tag: "1.2"}, false},
+		{"localhost/app:dev", imageRef{registry: "localhost", repository: "app", tag: "dev"}, false},
+		{"localhost:5000/app", imageRef{registry: "localhost:5000", repository: "app"}, false},
+		{"nginx@" + digest, imageRef{registry: "docker.io", repository: "library/nginx", digest: digest}, true},
+		{"registry.example.com/team/app:1.2@" + digest, imageRef{registry: "registry.example.com", repository: "team/app", tag: "1.2", digest: digest}, true},
+		{"registry.example.com:5000/app@" + digest, imageRef{registry: "registry.example.com:5000", repository: "app", digest: digest}, true},
+	}
+	for _, tt := range tests {
+		got := parseImageRef(tt.ref)
+		if got != tt.want {
+			t.Errorf("parseImageRef(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+		if got.pinned() != tt.wantPinned {
+			t.Errorf("parseImageRef(%q).pinned() = %v, want %v", tt.ref, got.pinned(), tt.wantPinned)
+		}
+	}
+}
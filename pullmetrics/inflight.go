@@ -0,0 +1,59 @@
+package pullmetrics
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// newInFlightPulls returns the map holding the node of every pull that
+// started (Pulling) but hasn't finished (Pulled/Failed) yet, keyed like the
+// pull failures. Entries whose terminal event never arrives expire so the
+// in-flight counter can't leak.
+func (h *Handler) newInFlightPulls() *ttlMap[string, string] {
+	m := newTTLMap[string, string]("in_flight", h.opts().inFlightTTL, h.opts().cacheMaxEntries)
+	m.onExpire = func(_ string, node string) {
+		h.inFlightCounter.Add(context.Background(), -1, h.inFlightAttributes(node))
+	}
+	return m
+}
+
+func (h *Handler) inFlightAttributes(node string) metric.MeasurementOption {
+	return metric.WithAttributes(append(h.clusterAttributes(), h.attrKey("host").String(node))...)
+}
+
+// startPull counts a Pulling event as an in-flight pull on its node.
+func (h *Handler) startPull(ctx context.Context, event *v1.Event) {
+	if !strings.HasPrefix(event.Message, "Pulling image") {
+		return
+	}
+	matches := failedImageRe.FindStringSubmatch(event.Message)
+	if len(matches) < 2 || !h.registryAllowed(parseImageRef(matches[1]).registry) {
+		return
+	}
+
+	started := false
+	h.inFlightPulls.update(pullKey(event, matches[1]), func(_ string, found bool) string {
+		started = !found
+		return eventHost(event)
+	})
+	if started {
+		h.record(ctx, func(ctx context.Context) {
+			h.inFlightCounter.Add(ctx, 1, h.inFlightAttributes(eventHost(event)))
+		})
+	}
+}
+
+// finishPull stops counting the pull of image for the event's pod, if it was
+// being counted.
+func (h *Handler) finishPull(ctx context.Context, event *v1.Event, image string) {
+	node, ok := h.inFlightPulls.delete(pullKey(event, image))
+	if !ok {
+		return
+	}
+	h.record(ctx, func(ctx context.Context) {
+		h.inFlightCounter.Add(ctx, -1, h.inFlightAttributes(node))
+	})
+}
@@ -0,0 +1,138 @@
+package pullmetrics
+
+import (
+	"context"
+	"log"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// objectCache serves the object lookups used to enrich pull events.
+// Reads are answered from shared informer caches so a burst of events doesn't
+// turn into a burst of API requests. Objects that aren't in the cache yet
+// (e.g. a pod created moments before its first event) fall back to a direct
+// Get, throttled by a token bucket so misses can't overwhelm the API server.
+// A nil objectCache finds nothing.
+type objectCache struct {
+	client kubernetes.Interface
+	pods   corelisters.PodLister
+	nodes  corelisters.NodeLister
+	jobs   batchlisters.JobLister
+	// replicaSets are looked up to tell rollouts from scale-ups
+	replicaSets appslisters.ReplicaSetLister
+	// namespaces is only watched when a namespace label is configured
+	namespaces corelisters.NamespaceLister
+	limiter    flowcontrol.RateLimiter
+	// disabled, if set, skips lookups while it returns true
+	disabled func() bool
+}
+
+// newObjectCache registers the listers of the objects used for enrichment
+// with the factory configured by WithLookups, or returns nil without one.
+func newObjectCache(o options) *objectCache {
+	if o.factory == nil {
+		return nil
+	}
+	c := &objectCache{
+		client:      o.client,
+		pods:        o.factory.Core().V1().Pods().Lister(),
+		nodes:       o.factory.Core().V1().Nodes().Lister(),
+		jobs:        o.factory.Batch().V1().Jobs().Lister(),
+		replicaSets: o.factory.Apps().V1().ReplicaSets().Lister(),
+		limiter:     flowcontrol.NewTokenBucketRateLimiter(o.lookupQPS, o.lookupBurst),
+		disabled:    o.lookupsOff,
+	}
+	if o.namespaceLabel != "" {
+		c.namespaces = o.factory.Core().V1().Namespaces().Lister()
+	}
+	return c
+}
+
+// getPod returns the named pod, or false if it can't be found without
+// exceeding the lookup rate limit.
+func (c *objectCache) getPod(namespace, name string) (*v1.Pod, bool) {
+	return lookup(c, "pod", namespace+"/"+name,
+		func() (*v1.Pod, error) { return c.pods.Pods(namespace).Get(name) },
+		func(ctx context.Context) (*v1.Pod, error) {
+			return c.client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		})
+}
+
+// getNode returns the named node, or false if it can't be found without
+// exceeding the lookup rate limit.
+func (c *objectCache) getNode(name string) (*v1.Node, bool) {
+	return lookup(c, "node", name,
+		func() (*v1.Node, error) { return c.nodes.Get(name) },
+		func(ctx context.Context) (*v1.Node, error) {
+			return c.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		})
+}
+
+// getNamespace returns the named namespace, or false if namespaces aren't
+// watched or it can't be found without exceeding the lookup rate limit.
+func (c *objectCache) getNamespace(name string) (*v1.Namespace, bool) {
+	if c == nil || c.namespaces == nil {
+		return nil, false
+	}
+	return lookup(c, "namespace", name,
+		func() (*v1.Namespace, error) { return c.namespaces.Get(name) },
+		func(ctx context.Context) (*v1.Namespace, error) {
+			return c.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		})
+}
+
+// getJob returns the named job, or false if it can't be found without
+// exceeding the lookup rate limit.
+func (c *objectCache) getJob(namespace, name string) (*batchv1.Job, bool) {
+	return lookup(c, "job", namespace+"/"+name,
+		func() (*batchv1.Job, error) { return c.jobs.Jobs(namespace).Get(name) },
+		func(ctx context.Context) (*batchv1.Job, error) {
+			return c.client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		})
+}
+
+// getReplicaSet returns the named ReplicaSet, or false if it can't be found
+// without exceeding the lookup rate limit.
+func (c *objectCache) getReplicaSet(namespace, name string) (*appsv1.ReplicaSet, bool) {
+	return lookup(c, "replicaset", namespace+"/"+name,
+		func() (*appsv1.ReplicaSet, error) { return c.replicaSets.ReplicaSets(namespace).Get(name) },
+		func(ctx context.Context) (*appsv1.ReplicaSet, error) {
+			return c.client.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		})
+}
+
+// lookup reads an object from the informer cache, falling back to a rate
+// limited API request when the cache doesn't have it. Lookups are skipped
+// while c.disabled returns true.
+func lookup[T any](c *objectCache, kind, key string, fromCache func() (T, error), fromAPI func(context.Context) (T, error)) (T, bool) {
+	var zero T
+	if c == nil || c.disabled != nil && c.disabled() {
+		return zero, false
+	}
+	obj, err := fromCache()
+	if err == nil {
+		return obj, true
+	}
+	if !apierrors.IsNotFound(err) || !c.limiter.TryAccept() {
+		return zero, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	obj, err = fromAPI(ctx)
+	if err != nil {
+		log.Println("Failed to look up", kind, key+":", err)
+		return zero, false
+	}
+	return obj, true
+}
@@ -0,0 +1,18 @@
+package pullmetrics
+
+import "go.opentelemetry.io/otel/attribute"
+
+// namespaceAttributes returns the attributes describing the namespace a pull
+// happened in. The team attribute is left out when no namespace label is
+// configured or the namespace doesn't have the label.
+func (h *Handler) namespaceAttributes(name string) []attribute.KeyValue {
+	ns, ok := h.lookups.getNamespace(name)
+	if !ok {
+		return nil
+	}
+	team, ok := ns.Labels[h.opts().namespaceLabel]
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{h.attrKey("team").String(team)}
+}
@@ -0,0 +1,47 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespaceTeam(t *testing.T) {
+	lookups := withFakeLookups(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"team": "billing"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "scratch", Labels: map[string]string{"owner": "alice"}}},
+	)
+	tests := []struct {
+		name      string
+		label     string
+		namespace string
+		wantTeam  string
+		wantFound bool
+	}{
+		{name: "labeled", label: "team", namespace: "payments", wantTeam: "billing", wantFound: true},
+		{name: "unlabeled", label: "team", namespace: "scratch"},
+		{name: "missing namespace", label: "team", namespace: "gone"},
+		{name: "no label configured", namespace: "payments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, lookups, WithNamespaceLabel(tt.label))
+			event := podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000))
+			event.Namespace = tt.namespace
+			event.InvolvedObject.Namespace = tt.namespace
+			h.OnEvent(context.Background(), event)
+
+			points := collect(t, reader, "k8s.image.pull.duration")
+			if len(points) != 1 {
+				t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(points))
+			}
+			team, found := points[0].attributes.Value("exported.team")
+			if found != tt.wantFound || team.AsString() != tt.wantTeam {
+				t.Errorf("exported.team = %q (found %v), want %q (found %v)", team.AsString(), found, tt.wantTeam, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package pullmetrics
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+)
+
+// wellKnownNodePoolLabels are the node pool labels set by common managed
+// Kubernetes offerings and node provisioners, in order of preference. They
+// are tried when no node pool label is configured.
+var wellKnownNodePoolLabels = []string{
+	"cloud.google.com/gke-nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"alpha.eksctl.io/nodegroup-name",
+	"karpenter.sh/nodepool",
+	"kubernetes.azure.com/agentpool",
+	"doks.digitalocean.com/node-pool",
+}
+
+// nodeAttributes returns the attributes describing the node a pull happened
+// on. Attributes whose source isn't available are left out.
+func (h *Handler) nodeAttributes(nodeName string) []attribute.KeyValue {
+	node, ok := h.lookups.getNode(nodeName)
+	if !ok {
+		return nil
+	}
+
+	var attributes []attribute.KeyValue
+	if pool := h.nodePool(node); pool != "" {
+		attributes = append(attributes, h.attrKey("node.pool").String(pool))
+	}
+	if version := node.Status.NodeInfo.KubeletVersion; version != "" {
+		attributes = append(attributes, h.attrKey("kubelet.version").String(version))
+	}
+	if snapshotter := h.nodeSnapshotter(node); snapshotter != "" {
+		attributes = append(attributes, h.attrKey("node.snapshotter").String(snapshotter))
+	}
+	return attributes
+}
+
+// nodeSnapshotter returns the snapshotter or storage driver the node unpacks
+// images with, read from the configured label or annotation, or "" if
+// unknown. Neither kubelet nor the container runtimes report it, so it's
+// only known where node provisioning records it.
+func (h *Handler) nodeSnapshotter(node *v1.Node) string {
+	if h.opts().snapshotterLabel == "" {
+		return ""
+	}
+	if snapshotter, ok := node.Labels[h.opts().snapshotterLabel]; ok {
+		return snapshotter
+	}
+	return node.Annotations[h.opts().snapshotterLabel]
+}
+
+// nodePool returns the node pool the node belongs to, or "" if unknown.
+func (h *Handler) nodePool(node *v1.Node) string {
+	if h.opts().nodePoolLabel != "" {
+		return node.Labels[h.opts().nodePoolLabel]
+	}
+	for _, label := range wellKnownNodePoolLabels {
+		if pool, ok := node.Labels[label]; ok {
+			return pool
+		}
+	}
+	return ""
+}
+
+// nodeArchitecture returns the CPU architecture of the node as reported by
+// kubelet, defaulting to amd64 when the node can't be looked up.
+func (h *Handler) nodeArchitecture(nodeName string) string {
+	node, ok := h.lookups.getNode(nodeName)
+	if !ok || node.Status.NodeInfo.Architecture == "" {
+		return "amd64"
+	}
+	return node.Status.NodeInfo.Architecture
+}
@@ -0,0 +1,135 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pullOn records a pull on node and returns the attributes of the recorded
+// duration.
+func pullOn(t *testing.T, node string, opts ...Option) dataPoint {
+	t.Helper()
+	h, reader := newTestHandler(t, opts...)
+	event := podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000))
+	event.Source.Host = node
+	h.OnEvent(context.Background(), event)
+
+	points := collect(t, reader, "k8s.image.pull.duration")
+	if len(points) != 1 {
+		t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(points))
+	}
+	return points[0]
+}
+
+func TestKubeletVersion(t *testing.T) {
+	lookups := withFakeLookups(
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.32.1-eks-5d632ec"}},
+		},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	)
+	tests := []struct {
+		node string
+		want string
+	}{
+		{node: "node-1", want: "v1.32.1-eks-5d632ec"},
+		// not reported yet
+		{node: "node-2", want: ""},
+		{node: "gone", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			p := pullOn(t, tt.node, lookups)
+			got, found := p.attributes.Value("exported.kubelet.version")
+			if found != (tt.want != "") || got.AsString() != tt.want {
+				t.Errorf("exported.kubelet.version = %q (found %v), want %q", got.AsString(), found, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodePool(t *testing.T) {
+	node := func(name string, labels map[string]string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	lookups := withFakeLookups(
+		node("gke", map[string]string{"cloud.google.com/gke-nodepool": "default-pool"}),
+		node("eks", map[string]string{"eks.amazonaws.com/nodegroup": "workers"}),
+		node("eksctl", map[string]string{"alpha.eksctl.io/nodegroup-name": "ng-1"}),
+		node("karpenter", map[string]string{"karpenter.sh/nodepool": "spot"}),
+		node("aks", map[string]string{"kubernetes.azure.com/agentpool": "agentpool"}),
+		node("doks", map[string]string{"doks.digitalocean.com/node-pool": "pool-1"}),
+		// managed node groups provisioned by eksctl carry both labels
+		node("both", map[string]string{"alpha.eksctl.io/nodegroup-name": "ng-1", "eks.amazonaws.com/nodegroup": "workers"}),
+		node("custom", map[string]string{"pool": "batch", "karpenter.sh/nodepool": "spot"}),
+		node("unlabeled", nil),
+	)
+	tests := []struct {
+		node  string
+		label string
+		want  string
+	}{
+		{node: "gke", want: "default-pool"},
+		{node: "eks", want: "workers"},
+		{node: "eksctl", want: "ng-1"},
+		{node: "karpenter", want: "spot"},
+		{node: "aks", want: "agentpool"},
+		{node: "doks", want: "pool-1"},
+		{node: "both", want: "workers"},
+		{node: "custom", label: "pool", want: "batch"},
+		// a configured label replaces the well-known ones
+		{node: "karpenter", label: "pool", want: ""},
+		{node: "unlabeled", want: ""},
+		{node: "gone", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node+"/"+tt.label, func(t *testing.T) {
+			p := pullOn(t, tt.node, lookups, WithNodePoolLabel(tt.label))
+			got, found := p.attributes.Value("exported.node.pool")
+			if found != (tt.want != "") || got.AsString() != tt.want {
+				t.Errorf("exported.node.pool = %q (found %v), want %q", got.AsString(), found, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeSnapshotter(t *testing.T) {
+	lookups := withFakeLookups(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "labeled", Labels: map[string]string{"example.com/snapshotter": "stargz"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "annotated", Annotations: map[string]string{"example.com/snapshotter": "overlayfs"}}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:        "both",
+			Labels:      map[string]string{"example.com/snapshotter": "soci"},
+			Annotations: map[string]string{"example.com/snapshotter": "overlayfs"},
+		}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}},
+	)
+	tests := []struct {
+		node  string
+		label string
+		want  string
+	}{
+		{node: "labeled", label: "example.com/snapshotter", want: "stargz"},
+		{node: "annotated", label: "example.com/snapshotter", want: "overlayfs"},
+		// the label takes precedence over the annotation
+		{node: "both", label: "example.com/snapshotter", want: "soci"},
+		{node: "unlabeled", label: "example.com/snapshotter", want: ""},
+		{node: "gone", label: "example.com/snapshotter", want: ""},
+		// disabled
+		{node: "labeled", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.node+"/"+tt.label, func(t *testing.T) {
+			p := pullOn(t, tt.node, lookups, WithSnapshotterLabel(tt.label))
+			got, found := p.attributes.Value("exported.node.snapshotter")
+			if found != (tt.want != "") || got.AsString() != tt.want {
+				t.Errorf("exported.node.snapshotter = %q (found %v), want %q", got.AsString(), found, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package pullmetrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// nodeEventComponent is the source component of the Events created on
+	// slow nodes, which the Handler never processes itself.
+	nodeEventComponent = "k8s-image-pull-metrics"
+	// slowPullsReason is the reason of the Events created on slow nodes.
+	slowPullsReason = "SlowImagePulls"
+)
+
+// slowStreak is a run of consecutive slow pulls on a node.
+type slowStreak struct {
+	since   time.Time
+	pulls   int
+	slowest time.Duration
+}
+
+// nodeEventer creates a Warning Event on a Node once it pulled slower than a
+// threshold several times in a row within a window, so chronic slowness,
+// e.g. a saturated disk or network link, shows up in kubectl describe node.
+// Each node gets at most one Event per window, and Events are created on a
+// separate goroutine behind a bounded queue.
+type nodeEventer struct {
+	client    kubernetes.Interface
+	threshold time.Duration
+	window    time.Duration
+	pulls     int
+	queue     chan *v1.Event
+	// streaks holds the current run of slow pulls of each node
+	streaks *ttlMap[string, slowStreak]
+	// reported holds the nodes an Event was created for within the window
+	reported *ttlMap[string, struct{}]
+}
+
+func newNodeEventer(client kubernetes.Interface, threshold, window time.Duration, pulls, maxEntries int) *nodeEventer {
+	e := &nodeEventer{
+		client:    client,
+		threshold: threshold,
+		window:    window,
+		pulls:     max(pulls, 1),
+		queue:     make(chan *v1.Event, 100),
+		streaks:   newTTLMap[string, slowStreak]("slow_pull_streaks", window, maxEntries),
+		reported:  newTTLMap[string, struct{}]("reported_nodes", window, maxEntries),
+	}
+	go e.run()
+	return e
+}
+
+// check extends the streak of slow pulls of the event's node, or ends it if
+// the pull was fast, and queues an Event once the streak is long enough.
+func (e *nodeEventer) check(event *v1.Event, info PullInfo) {
+	node := eventHost(event)
+	if node == "" {
+		return
+	}
+	if info.PullDuration <= e.threshold {
+		e.streaks.delete(node)
+		return
+	}
+
+	now := time.Now()
+	var streak slowStreak
+	e.streaks.update(node, func(s slowStreak, found bool) slowStreak {
+		if !found || now.Sub(s.since) > e.window {
+			s = slowStreak{since: now}
+		}
+		s.pulls++
+		s.slowest = max(s.slowest, info.PullDuration)
+		streak = s
+		return s
+	})
+	if streak.pulls < e.pulls {
+		return
+	}
+	e.streaks.delete(node)
+
+	reported := false
+	e.reported.update(node, func(_ struct{}, found bool) struct{} {
+		reported = found
+		return struct{}{}
+	})
+	if reported {
+		log.Println("Not creating another", slowPullsReason, "event for", node, "within", e.window)
+		return
+	}
+
+	select {
+	case e.queue <- e.newEvent(node, streak, now):
+	default:
+		log.Println("Node event queue full, dropping", slowPullsReason, "event for", node)
+	}
+}
+
+// newEvent returns the Event reporting streak on node. Like kubelet, it
+// refers to the node by name in place of its UID, which kubectl describe
+// node expects, and lives in the default namespace.
+func (e *nodeEventer) newEvent(node string, streak slowStreak, now time.Time) *v1.Event {
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: node + ".",
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind: "Node",
+			Name: node,
+			UID:  types.UID(node),
+		},
+		Reason: slowPullsReason,
+		Message: fmt.Sprintf("%d consecutive image pulls took longer than %v within %v, the slowest %v",
+			streak.pulls, e.threshold, e.window, streak.slowest.Round(time.Second)),
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: nodeEventComponent},
+		FirstTimestamp: metav1.NewTime(streak.since),
+		LastTimestamp:  metav1.NewTime(now),
+		Count:          1,
+	}
+}
+
+func (e *nodeEventer) run() {
+	for event := range e.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := e.client.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+		cancel()
+		if err != nil {
+			log.Println("Failed to create", slowPullsReason, "event for", event.InvolvedObject.Name+":", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package pullmetrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newEventClient returns a fake clientset that, like the API server, names
+// created Events after their GenerateName.
+func newEventClient() *fake.Clientset {
+	client := fake.NewClientset()
+	var created int
+	client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*v1.Event)
+		if event.Name == "" {
+			created++
+			event.Name = fmt.Sprintf("%s%d", event.GenerateName, created)
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+// nodeEvents returns the Events created through client once the eventer's
+// queue drained, polling as they are created asynchronously.
+func nodeEvents(t *testing.T, client *fake.Clientset, want int) []v1.Event {
+	t.Helper()
+	var events []v1.Event
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		list, err := client.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = list.Items
+		if len(events) >= want || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// give unexpected extra Events a chance to show up
+	time.Sleep(50 * time.Millisecond)
+	list, err := client.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+func TestNodeEventer(t *testing.T) {
+	const threshold = time.Minute
+	tests := []struct {
+		name    string
+		pulls   []time.Duration
+		want    int
+		slowest string
+	}{
+		{name: "slow streak", pulls: []time.Duration{2 * time.Minute, 3 * time.Minute, 90 * time.Second}, want: 1, slowest: "3m0s"},
+		{name: "too short", pulls: []time.Duration{2 * time.Minute, 3 * time.Minute}},
+		{name: "interrupted", pulls: []time.Duration{2 * time.Minute, 3 * time.Minute, time.Second, 2 * time.Minute, 2 * time.Minute}},
+		{name: "at threshold", pulls: []time.Duration{threshold, threshold, threshold}},
+		{name: "rate limited", pulls: []time.Duration{2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute, 2 * time.Minute}, want: 1, slowest: "2m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newEventClient()
+			e := newNodeEventer(client, threshold, time.Hour, 3, 100)
+			for _, d := range tt.pulls {
+				e.check(podEvent("", "web-1", "Pulled", ""), PullInfo{PullDuration: d})
+			}
+
+			events := nodeEvents(t, client, tt.want)
+			if len(events) != tt.want {
+				t.Fatalf("created %d events, want %d", len(events), tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			event := events[0]
+			if event.Reason != slowPullsReason || event.Type != v1.EventTypeWarning {
+				t.Errorf("event %s/%s, want %s/%s", event.Type, event.Reason, v1.EventTypeWarning, slowPullsReason)
+			}
+			if event.InvolvedObject.Kind != "Node" || event.InvolvedObject.Name != "node-1" {
+				t.Errorf("event involves %s %s, want Node node-1", event.InvolvedObject.Kind, event.InvolvedObject.Name)
+			}
+			if event.Source.Component != nodeEventComponent {
+				t.Errorf("event source = %q, want %q", event.Source.Component, nodeEventComponent)
+			}
+			wantMessage := "3 consecutive image pulls took longer than 1m0s within 1h0m0s, the slowest " + tt.slowest
+			if event.Message != wantMessage {
+				t.Errorf("event message = %q, want %q", event.Message, wantMessage)
+			}
+		})
+	}
+}
+
+func TestNodeEventerPerNode(t *testing.T) {
+	client := newEventClient()
+	e := newNodeEventer(client, time.Minute, time.Hour, 2, 100)
+	for _, node := range []string{"node-1", "node-2", "node-1", "node-2"} {
+		event := podEvent("", "web-1", "Pulled", "")
+		event.Source.Host = node
+		e.check(event, PullInfo{PullDuration: 2 * time.Minute})
+	}
+	if events := nodeEvents(t, client, 2); len(events) != 2 {
+		t.Errorf("created %d events, want one per node", len(events))
+	}
+}
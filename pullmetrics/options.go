@@ -0,0 +1,317 @@
+package pullmetrics
+
+import (
+	"time"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultDurationBuckets are the pull duration bucket boundaries in ms. Most
+// pulls finish within a few minutes, but slow registries or constrained
+// networks can take much longer (kubelet reports e.g. "1h2m3s"), so the upper
+// buckets keep 10, 15 and 30 minute pulls distinguishable instead of lumping
+// everything past 5 minutes into the overflow bucket.
+var DefaultDurationBuckets = []float64{15000, 30000, 45000, 60000, 120000, 180000, 240000, 300000, 600000, 900000, 1800000}
+
+// DefaultWaitDurationBuckets are the bucket boundaries in ms of the wait-only
+// histogram. Waits are typically far shorter than pulls, often well under
+// the first pull duration bucket.
+var DefaultWaitDurationBuckets = []float64{250, 500, 1000, 2500, 5000, 15000, 30000}
+
+// AggregationMode selects the attributes pulls are recorded with.
+type AggregationMode string
+
+const (
+	// AggregationDetailed records pulls with all attributes describing the
+	// pod, image and node involved.
+	AggregationDetailed AggregationMode = "detailed"
+	// AggregationCoarse records pulls with only the namespace, registry and
+	// node pool, for cheap long-term cluster-wide aggregates. Pods aren't
+	// looked up to derive attributes.
+	AggregationCoarse AggregationMode = "coarse"
+)
+
+// Option configures a Handler.
+type Option func(*options)
+
+type options struct {
+	attributePrefix        string
+	sourceComponent        string
+	sourceHandlerAttribute bool
+	aggregationMode        AggregationMode
+	durationBuckets        []float64
+	waitDurationBuckets    []float64
+	recordTimeout          time.Duration
+	cacheMaxEntries        int
+	failureTTL             time.Duration
+	inFlightTTL            time.Duration
+	minPullDuration        time.Duration
+	maxEventAge            time.Duration
+	flapThreshold          int
+	flapWindow             time.Duration
+	repullWindow           time.Duration
+	registryAllowlist      []string
+	registryDenylist       []string
+	nodePoolLabel          string
+	snapshotterLabel       string
+	namespaceLabel         string
+	messageTemplates       []MessageTemplate
+	clusterName            string
+	relabelRules           []RelabelRule
+	sloThresholds          []SLOThreshold
+	sizeGrowthThreshold    float64
+	sampleRate             float64
+	percentileWindow       time.Duration
+
+	client      kubernetes.Interface
+	factory     informers.SharedInformerFactory
+	lookupQPS   float32
+	lookupBurst int
+	lookupsOff  func() bool
+
+	records *RecordSink
+
+	enrichFromRegistry bool
+	registryConfig     string
+
+	alertWebhook   string
+	alertThreshold time.Duration
+	alertInterval  time.Duration
+
+	nodeEvents         bool
+	nodeEventThreshold time.Duration
+	nodeEventWindow    time.Duration
+	nodeEventSlowPulls int
+}
+
+func defaultOptions() options {
+	return options{
+		attributePrefix:     "exported.",
+		sourceComponent:     "kubelet",
+		aggregationMode:     AggregationDetailed,
+		durationBuckets:     DefaultDurationBuckets,
+		waitDurationBuckets: DefaultWaitDurationBuckets,
+		recordTimeout:       5 * time.Second,
+		cacheMaxEntries:     10000,
+		failureTTL:          30 * time.Minute,
+		inFlightTTL:         30 * time.Minute,
+		flapWindow:          10 * time.Minute,
+		messageTemplates:    DefaultMessageTemplates,
+		sampleRate:          1,
+	}
+}
+
+// WithAttributePrefix sets the prefix of the attributes describing the pulled
+// image and the pod it was pulled for. The default is "exported.".
+func WithAttributePrefix(prefix string) Option {
+	return func(o *options) { o.attributePrefix = prefix }
+}
+
+// WithSourceComponent sets the component whose events are processed,
+// matched case-insensitively against the start of the event's source or
+// reporting controller. The default is "kubelet".
+func WithSourceComponent(component string) Option {
+	return func(o *options) { o.sourceComponent = component }
+}
+
+// WithSourceHandlerAttribute records whether an event was delivered as a new
+// or an updated event as the event.source_handler attribute.
+func WithSourceHandlerAttribute(enabled bool) Option {
+	return func(o *options) { o.sourceHandlerAttribute = enabled }
+}
+
+// WithAggregationMode selects the attributes pulls are recorded with. The
+// default is AggregationDetailed.
+func WithAggregationMode(mode AggregationMode) Option {
+	return func(o *options) { o.aggregationMode = mode }
+}
+
+// WithDurationBuckets sets the bucket boundaries in ms of the duration
+// histograms. The default is DefaultDurationBuckets.
+func WithDurationBuckets(buckets []float64) Option {
+	return func(o *options) { o.durationBuckets = buckets }
+}
+
+// WithWaitDurationBuckets sets the bucket boundaries in ms of the wait-only
+// histogram. The default is DefaultWaitDurationBuckets.
+func WithWaitDurationBuckets(buckets []float64) Option {
+	return func(o *options) { o.waitDurationBuckets = buckets }
+}
+
+// WithRecordTimeout bounds how long recording the metrics of a single event
+// may block. The default is 5s.
+func WithRecordTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.recordTimeout = timeout }
+}
+
+// WithCacheMaxEntries bounds each in-memory correlation cache to n entries,
+// which must be positive. The default is 10000 entries.
+func WithCacheMaxEntries(n int) Option {
+	return func(o *options) { o.cacheMaxEntries = n }
+}
+
+// WithFailureTTL sets how long a failed pull is remembered when correlating
+// it with a later successful pull. The default is 30m.
+func WithFailureTTL(ttl time.Duration) Option {
+	return func(o *options) { o.failureTTL = ttl }
+}
+
+// WithInFlightTTL sets how long a started pull is counted as in flight
+// without a matching Pulled or Failed event. The default is 30m.
+func WithInFlightTTL(ttl time.Duration) Option {
+	return func(o *options) { o.inFlightTTL = ttl }
+}
+
+// WithMinPullDuration counts pulls faster than d in k8s.image.pull.cached
+// instead of the duration histograms.
+func WithMinPullDuration(d time.Duration) Option {
+	return func(o *options) { o.minPullDuration = d }
+}
+
+// WithMaxEventAge ignores events last observed more than age ago, such as
+// the backlog the informer replays on startup.
+func WithMaxEventAge(age time.Duration) Option {
+	return func(o *options) { o.maxEventAge = age }
+}
+
+// WithFlapThreshold only counts the pulls of a pod in k8s.image.pull.flapping
+// once it recorded more than threshold pulls within window.
+func WithFlapThreshold(threshold int, window time.Duration) Option {
+	return func(o *options) { o.flapThreshold, o.flapWindow = threshold, window }
+}
+
+// WithRepullWindow counts a pull in k8s.image.repull when the same node
+// pulled the same image within window.
+func WithRepullWindow(window time.Duration) Option {
+	return func(o *options) { o.repullWindow = window }
+}
+
+// WithRegistryFilter only records pulls from registries in allowlist, if not
+// empty, and never from those in denylist. Images without a registry host
+// match "docker.io".
+func WithRegistryFilter(allowlist, denylist []string) Option {
+	return func(o *options) {
+		o.registryAllowlist = normalizeRegistries(allowlist)
+		o.registryDenylist = normalizeRegistries(denylist)
+	}
+}
+
+// WithNodePoolLabel sets the node label recorded as the node.pool attribute.
+// By default well-known node pool labels are tried.
+func WithNodePoolLabel(label string) Option {
+	return func(o *options) { o.nodePoolLabel = label }
+}
+
+// WithSnapshotterLabel sets the node label, or annotation if there's no such
+// label, recorded as the node.snapshotter attribute, e.g. "overlayfs" or
+// "stargz". The attribute is left out by default.
+func WithSnapshotterLabel(label string) Option {
+	return func(o *options) { o.snapshotterLabel = label }
+}
+
+// WithNamespaceLabel records the value of the given label of the pull's
+// namespace as the team attribute.
+func WithNamespaceLabel(label string) Option {
+	return func(o *options) { o.namespaceLabel = label }
+}
+
+// WithMessageTemplates parses Pulled messages with templates, e.g. for
+// kubelet forks phrasing them differently, before trying
+// DefaultMessageTemplates.
+func WithMessageTemplates(templates ...MessageTemplate) Option {
+	return func(o *options) {
+		o.messageTemplates = append(append([]MessageTemplate{}, templates...), DefaultMessageTemplates...)
+	}
+}
+
+// WithRelabelRules rewrites the attributes of recorded pulls with rules,
+// applied in order.
+func WithRelabelRules(rules ...RelabelRule) Option {
+	return func(o *options) { o.relabelRules = rules }
+}
+
+// WithSLOThresholds counts pulls taking longer than the threshold of the
+// first matching registry pattern in k8s.image.pull.slo_violations.
+func WithSLOThresholds(thresholds ...SLOThreshold) Option {
+	return func(o *options) { o.sloThresholds = thresholds }
+}
+
+// WithSizeGrowthThreshold records k8s.image.size.growth when the size of an
+// image tag grew by more than percent since its previous pull. The last
+// sizes of at most WithCacheMaxEntries tags are kept, evicting the least
+// recently pulled.
+func WithSizeGrowthThreshold(percent float64) Option {
+	return func(o *options) { o.sizeGrowthThreshold = percent }
+}
+
+// WithSampleRate only records the given fraction of parsed pulls, between 0
+// and 1, chosen by a hash of the event UID. All pulls are still counted in
+// k8s.image.pulls, and retries, flapping, re-pulls and size growth are
+// detected across all of them. The default is 1.
+func WithSampleRate(rate float64) Option {
+	return func(o *options) { o.sampleRate = rate }
+}
+
+// WithPercentiles reports the 50th, 95th and 99th percentile of the
+// durations of the pulls from each registry within the last window as the
+// k8s.image.pull.duration.p50, .p95 and .p99 gauges. The last 1000
+// durations per registry are kept, for at most WithCacheMaxEntries
+// registries.
+func WithPercentiles(window time.Duration) Option {
+	return func(o *options) { o.percentileWindow = window }
+}
+
+// WithClusterName records name as the k8s.cluster.name attribute of every
+// measurement, to tell apart the clusters of several Handlers sharing a
+// meter.
+func WithClusterName(name string) Option {
+	return func(o *options) { o.clusterName = name }
+}
+
+// WithLookups enriches pulls with the pods, nodes, jobs and namespaces served
+// by factory, falling back to direct API requests through client at up to
+// qps. The caller starts factory once New returned. Without lookups the
+// attributes derived from those objects are left out.
+func WithLookups(client kubernetes.Interface, factory informers.SharedInformerFactory, qps float32, burst int) Option {
+	return func(o *options) {
+		o.client, o.factory, o.lookupQPS, o.lookupBurst = client, factory, qps, burst
+	}
+}
+
+// WithLookupsDisabledWhile skips object lookups while disabled returns true,
+// e.g. while exports are failing.
+func WithLookupsDisabledWhile(disabled func() bool) Option {
+	return func(o *options) { o.lookupsOff = disabled }
+}
+
+// WithRecordSink streams every parsed pull to sink.
+func WithRecordSink(sink *RecordSink) Option {
+	return func(o *options) { o.records = sink }
+}
+
+// WithRegistryEnrichment fetches the manifest of pulled images from their
+// registry to record k8s.image.layer.count, using the credentials of the
+// Docker config file at configFile if not empty.
+func WithRegistryEnrichment(configFile string) Option {
+	return func(o *options) { o.enrichFromRegistry, o.registryConfig = true, configFile }
+}
+
+// WithAlerts POSTs a JSON alert to webhook for every pull taking longer than
+// threshold, at most once per node within interval.
+func WithAlerts(webhook string, threshold, interval time.Duration) Option {
+	return func(o *options) {
+		o.alertWebhook, o.alertThreshold, o.alertInterval = webhook, threshold, interval
+	}
+}
+
+// WithNodeEvents creates a Warning Event with reason SlowImagePulls on a
+// Node once pulls consecutive pulls on it took longer than threshold within
+// window, at most once per node within window. It requires WithLookups,
+// whose client creates the Events.
+func WithNodeEvents(threshold, window time.Duration, pulls int) Option {
+	return func(o *options) {
+		o.nodeEvents = true
+		o.nodeEventThreshold, o.nodeEventWindow, o.nodeEventSlowPulls = threshold, window, pulls
+	}
+}
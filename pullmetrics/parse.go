@@ -0,0 +1,197 @@
+package pullmetrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PullInfo is what kubelet reports about a successful image pull.
+type PullInfo struct {
+	Image string
+	// PullDuration is the time spent pulling the image
+	PullDuration time.Duration
+	// TotalDuration additionally includes the time spent waiting for other
+	// pulls on the node to finish
+	TotalDuration time.Duration
+	Size          int64
+}
+
+// WaitDuration is the time the pull spent waiting before it started. It's
+// clamped to zero when the duration including waiting is shorter than the
+// pull duration, see NegativeWait.
+func (p PullInfo) WaitDuration() time.Duration {
+	return max(p.TotalDuration-p.PullDuration, 0)
+}
+
+// NegativeWait reports whether the duration including waiting is shorter
+// than the pull duration, e.g. due to rounding or an inverted message.
+func (p PullInfo) NegativeWait() bool {
+	return p.TotalDuration < p.PullDuration
+}
+
+// WaitRatio is the share of the total duration spent waiting, which grows
+// when kubelet serializes pulls or limits their parallelism. It returns false
+// when the total duration is zero.
+func (p PullInfo) WaitRatio() (float64, bool) {
+	if p.TotalDuration <= 0 {
+		return 0, false
+	}
+	return float64(p.WaitDuration()) / float64(p.TotalDuration), true
+}
+
+// MessageTemplate is a regular expression matching the message of a Pulled
+// event. It must capture the image and the pull duration in groups named
+// "image" and "pull", and may capture the duration including waiting as
+// "wait" and the image size as "size", in a format accepted by parseSize.
+type MessageTemplate struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// ParseMessageTemplate compiles pattern into a template named name.
+func ParseMessageTemplate(name, pattern string) (MessageTemplate, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return MessageTemplate{}, fmt.Errorf("message template %q: %w", name, err)
+	}
+	for _, group := range []string{"image", "pull"} {
+		if re.SubexpIndex(group) < 0 {
+			return MessageTemplate{}, fmt.Errorf("message template %q: missing capture group %q", name, group)
+		}
+	}
+	return MessageTemplate{Name: name, Pattern: re}, nil
+}
+
+// DefaultMessageTemplates match the messages of kubelet releases, newest
+// first. They are tried after any templates configured with
+// WithMessageTemplates.
+//
+// input: "Successfully pulled image \"<account-id>.dkr.ecr.ap-southeast-1.amazonaws.com/example-service:99cd3b4\" in 1m44.643s (1m44.643s including waiting). Image size: 1169083618 bytes."
+var DefaultMessageTemplates = []MessageTemplate{
+	mustParseMessageTemplate("with-size", `^Successfully pulled image "(?P<image>[^"]+)" in (?P<pull>\S+) \((?P<wait>\S+) including waiting\)\. Image size: (?P<size>\d+(?:\.\d+)? ?[A-Za-z]*)\.?$`),
+	mustParseMessageTemplate("without-size", `^Successfully pulled image "(?P<image>[^"]+)" in (?P<pull>\S+) \((?P<wait>\S+) including waiting\)$`),
+	mustParseMessageTemplate("without-wait", `^Successfully pulled image "(?P<image>[^"]+)" in (?P<pull>\S+)$`),
+}
+
+func mustParseMessageTemplate(name, pattern string) MessageTemplate {
+	t, err := ParseMessageTemplate(name, pattern)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ParsePulledMessage parses the message of a kubelet Pulled event with the
+// first of templates that matches it. Without a captured wait the pull
+// didn't wait, and without a captured size it's left at zero.
+func ParsePulledMessage(msg string, templates []MessageTemplate) (PullInfo, error) {
+	for _, t := range templates {
+		matches := t.Pattern.FindStringSubmatch(msg)
+		if matches == nil {
+			continue
+		}
+		group := func(name string) string {
+			if i := t.Pattern.SubexpIndex(name); i >= 0 {
+				return matches[i]
+			}
+			return ""
+		}
+
+		info := PullInfo{Image: group("image")}
+		var err error
+		info.PullDuration, err = parseDuration(group("pull"))
+		if err != nil {
+			return info, fmt.Errorf("parsing pull duration: %w", err)
+		}
+		info.TotalDuration = info.PullDuration
+		if wait := group("wait"); wait != "" {
+			info.TotalDuration, err = parseDuration(wait)
+			if err != nil {
+				return info, fmt.Errorf("parsing duration including waiting: %w", err)
+			}
+		}
+		if size := group("size"); size != "" {
+			info.Size, err = parseSize(size)
+			if err != nil {
+				return info, fmt.Errorf("parsing image size: %w", err)
+			}
+		}
+		return info, nil
+	}
+	return PullInfo{}, fmt.Errorf("no message template matches %q", msg)
+}
+
+// sizeUnitPrefixes are the unit prefixes parseSize accepts, in increasing
+// order of magnitude.
+const sizeUnitPrefixes = "KMGT"
+
+// parseSize parses an image size as reported by kubelet, either a byte count
+// such as "1169083618 bytes" or a human-readable size some container runtimes
+// report, such as "1.1 GB" or "512Mi". Decimal units (kB or KB, MB, GB, TB,
+// and K, M, G, T as in Kubernetes quantities) are powers of 1000, binary
+// units (KiB or Ki, MiB or Mi, GiB or Gi, TiB or Ti) powers of 1024.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	number, unit := s[:i], strings.TrimSpace(s[i:])
+
+	switch strings.ToLower(unit) {
+	case "", "b", "byte", "bytes":
+		return strconv.ParseInt(number, 10, 64)
+	}
+
+	prefix := strings.TrimSuffix(unit, "B")
+	base := 1000.0
+	if p, ok := strings.CutSuffix(prefix, "i"); ok {
+		prefix, base = p, 1024
+	}
+	exp := strings.Index(sizeUnitPrefixes, strings.ToUpper(prefix)) + 1
+	if len(prefix) != 1 || exp == 0 {
+		return 0, fmt.Errorf("unknown size unit %q", unit)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	bytes := math.Round(value * math.Pow(base, float64(exp)))
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q out of range", s)
+	}
+	return int64(bytes), nil
+}
+
+// alreadyPresentRe matches the message of the Pulled event kubelet emits
+// when the image didn't need pulling, e.g.
+// `Container image "nginx:1.25" already present on machine`.
+var alreadyPresentRe = regexp.MustCompile(`^Container image "([^"]+)" already present on machine`)
+
+// parseAlreadyPresentMessage returns the image of an "already present"
+// message, or false for other messages.
+func parseAlreadyPresentMessage(msg string) (string, bool) {
+	matches := alreadyPresentRe.FindStringSubmatch(msg)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// parseDuration parses a duration reported by kubelet. Negative durations
+// are rejected; they can only come from a garbled message, and subtracting
+// them from one another could overflow.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
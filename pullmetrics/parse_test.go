@@ -0,0 +1,183 @@
+package pullmetrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParsePulledMessage(t *testing.T) {
+	custom := mustParseMessageTemplate("cri-o", `^Pulled image "(?P<image>[^"]+)" after (?P<pull>\S+)$`)
+	tests := []struct {
+		name      string
+		templates []MessageTemplate
+		msg       string
+		want      PullInfo
+		wantErr   bool
+	}{
+		{
+			name: "with size",
+			msg:  `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1000 bytes.`,
+			want: PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 2 * time.Second, Size: 1000},
+		},
+		{
+			name: "with human-readable size",
+			msg:  `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1.1 GB`,
+			want: PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 2 * time.Second, Size: 1_100_000_000},
+		},
+		{
+			name: "without size",
+			msg:  `Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting)`,
+			want: PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 2 * time.Second},
+		},
+		{
+			name: "without wait",
+			msg:  `Successfully pulled image "nginx:1.27" in 1.5s`,
+			want: PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 1500 * time.Millisecond},
+		},
+		{
+			name:    "unknown message",
+			msg:     `Pulled image "nginx:1.27" after 1.5s`,
+			wantErr: true,
+		},
+		{
+			name:      "custom template",
+			templates: []MessageTemplate{custom},
+			msg:       `Pulled image "nginx:1.27" after 1.5s`,
+			want:      PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 1500 * time.Millisecond},
+		},
+		{
+			name:      "default templates after custom ones",
+			templates: []MessageTemplate{custom},
+			msg:       `Successfully pulled image "nginx:1.27" in 1.5s`,
+			want:      PullInfo{Image: "nginx:1.27", PullDuration: 1500 * time.Millisecond, TotalDuration: 1500 * time.Millisecond},
+		},
+		{
+			name:    "invalid duration",
+			msg:     `Successfully pulled image "nginx:1.27" in 1.5 (2s including waiting)`,
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			msg:     `Successfully pulled image "nginx:1.27" in -1.5s`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePulledMessage(tt.msg, append(tt.templates, DefaultMessageTemplates...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePulledMessage(%q) error = %v, want error %v", tt.msg, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParsePulledMessage(%q) = %+v, want %+v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageTemplateRejectsInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		`^Pulled image "(?P<image>[^"]+)"$`,
+		`^Pulled after (?P<pull>\S+)$`,
+		`^Pulled image "(?P<image>[^"]+" after (?P<pull>\S+)$`,
+	} {
+		if _, err := ParseMessageTemplate("test", pattern); err == nil {
+			t.Errorf("ParseMessageTemplate(%q) succeeded, want an error", pattern)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "1169083618 bytes", want: 1169083618},
+		{s: "1169083618", want: 1169083618},
+		{s: "512 B", want: 512},
+		{s: "1.1 GB", want: 1_100_000_000},
+		{s: "1.1GB", want: 1_100_000_000},
+		{s: "250 kB", want: 250_000},
+		{s: "250 KB", want: 250_000},
+		{s: "3M", want: 3_000_000},
+		{s: "512Mi", want: 512 << 20},
+		{s: "1.5 GiB", want: 3 << 29},
+		{s: "2Ti", want: 2 << 40},
+		{s: "1.5 bytes", wantErr: true},
+		{s: "10 PB", wantErr: true},
+		{s: "10 MiBs", wantErr: true},
+		{s: "GB", wantErr: true},
+		{s: "99999999999 TB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func FuzzParsePulledMessage(f *testing.F) {
+	for _, msg := range []string{
+		// with size
+		`Successfully pulled image "123456789012.dkr.ecr.ap-southeast-1.amazonaws.com/example-service:99cd3b4" in 1m44.643s (1m44.643s including waiting). Image size: 1169083618 bytes.`,
+		`Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting). Image size: 1.1 GB`,
+		// without size
+		`Successfully pulled image "nginx:1.27" in 1.5s (2s including waiting)`,
+		// without wait
+		`Successfully pulled image "nginx:1.27" in 1.5s`,
+		// hours
+		`Successfully pulled image "registry.example.com/big@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" in 1h2m3s (1h2m3.5s including waiting). Image size: 512Mi.`,
+		`Container image "nginx:1.27" already present on machine`,
+	} {
+		f.Add(msg)
+	}
+
+	f.Fuzz(func(t *testing.T, msg string) {
+		info, err := ParsePulledMessage(msg, DefaultMessageTemplates)
+		if err != nil {
+			return
+		}
+		if info.PullDuration < 0 || info.TotalDuration < 0 {
+			t.Errorf("ParsePulledMessage(%q) = negative durations %v, %v", msg, info.PullDuration, info.TotalDuration)
+		}
+		if info.WaitDuration() < 0 {
+			t.Errorf("ParsePulledMessage(%q) = negative wait %v", msg, info.WaitDuration())
+		}
+		if info.Size < 0 {
+			t.Errorf("ParsePulledMessage(%q) = negative size %d", msg, info.Size)
+		}
+		if info.Image == "" {
+			t.Errorf("ParsePulledMessage(%q) = empty image", msg)
+		}
+	})
+}
+
+func TestPullInfoWaitRatio(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      PullInfo
+		wantRatio float64
+		wantOK    bool
+	}{
+		{name: "mostly waiting", info: PullInfo{PullDuration: time.Second, TotalDuration: 4 * time.Second}, wantRatio: 0.75, wantOK: true},
+		{name: "negligible wait", info: PullInfo{PullDuration: 999 * time.Millisecond, TotalDuration: time.Second}, wantRatio: 0.001, wantOK: true},
+		{name: "no wait", info: PullInfo{PullDuration: time.Second, TotalDuration: time.Second}, wantRatio: 0, wantOK: true},
+		{name: "negative wait", info: PullInfo{PullDuration: 2 * time.Second, TotalDuration: time.Second}, wantRatio: 0, wantOK: true},
+		{name: "zero total", info: PullInfo{}, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.info.WaitRatio()
+			if ok != tt.wantOK || math.Abs(got-tt.wantRatio) > 1e-9 {
+				t.Errorf("WaitRatio() = %v, %v, want %v, %v", got, ok, tt.wantRatio, tt.wantOK)
+			}
+		})
+	}
+}
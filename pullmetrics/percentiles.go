@@ -0,0 +1,149 @@
+package pullmetrics
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// pullPercentiles are the gauges reporting percentiles of the pull
+// durations within the sliding window.
+var pullPercentiles = []struct {
+	name        string
+	description string
+	quantile    float64
+}{
+	{"k8s.image.pull.duration.p50", "The median duration of the image pulls from a registry within the sliding window.", 0.50},
+	{"k8s.image.pull.duration.p95", "The 95th percentile duration of the image pulls from a registry within the sliding window.", 0.95},
+	{"k8s.image.pull.duration.p99", "The 99th percentile duration of the image pulls from a registry within the sliding window.", 0.99},
+}
+
+// maxWindowSamples bounds the durations kept per registry, dropping the
+// oldest first, so a burst of pulls can't grow a window without bound.
+const maxWindowSamples = 1000
+
+type durationSample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// durationWindow keeps the pull durations of each registry within a sliding
+// window to compute percentiles from. Pulls are rare enough that keeping the
+// samples is cheap, and unlike a sketch such as a t-digest the percentiles
+// of the kept samples are exact. Beyond maxWindowSamples pulls within the
+// window only the most recent ones are kept, so the percentiles then cover
+// a sample of the window rather than all of it. At most maxEntries
+// registries are tracked, ignoring pulls from any further ones until others
+// expire.
+type durationWindow struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxEntries int
+	// samples holds the durations of each registry, oldest first
+	samples map[string][]durationSample
+}
+
+func newDurationWindow(window time.Duration, maxEntries int) *durationWindow {
+	return &durationWindow{
+		window:     window,
+		maxEntries: maxEntries,
+		samples:    make(map[string][]durationSample),
+	}
+}
+
+func (w *durationWindow) add(registry string, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	samples, ok := w.samples[registry]
+	if !ok && len(w.samples) >= w.maxEntries {
+		return
+	}
+	samples = append(w.expire(samples, now), durationSample{at: now, duration: d})
+	if len(samples) > maxWindowSamples {
+		samples = samples[len(samples)-maxWindowSamples:]
+	}
+	w.samples[registry] = samples
+}
+
+// expire drops the samples older than the window.
+func (w *durationWindow) expire(samples []durationSample, now time.Time) []durationSample {
+	i := 0
+	for i < len(samples) && now.Sub(samples[i].at) > w.window {
+		i++
+	}
+	return samples[i:]
+}
+
+// percentiles calls fn with the given quantiles of the durations of each
+// registry within the window, by the nearest-rank method, and forgets
+// registries without any.
+func (w *durationWindow) percentiles(quantiles []float64, fn func(registry string, values []time.Duration)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for registry, samples := range w.samples {
+		samples = w.expire(samples, now)
+		if len(samples) == 0 {
+			delete(w.samples, registry)
+			continue
+		}
+		w.samples[registry] = samples
+
+		sorted := make([]time.Duration, len(samples))
+		for i, s := range samples {
+			sorted[i] = s.duration
+		}
+		slices.Sort(sorted)
+		values := make([]time.Duration, len(quantiles))
+		for i, q := range quantiles {
+			rank := int(math.Ceil(q * float64(len(sorted))))
+			values[i] = sorted[max(rank-1, 0)]
+		}
+		fn(registry, values)
+	}
+}
+
+func (w *durationWindow) cacheName() string {
+	return "pull_duration_windows"
+}
+
+func (w *durationWindow) size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.samples)
+}
+
+// registerPercentileGauges reports the percentiles of the pull durations
+// of each registry within the window as gauges, for backends without good
+// histogram support. Like registerCacheSizeGauge, the callback is registered
+// separately so that several Handlers sharing a meter each report theirs.
+func (h *Handler) registerPercentileGauges(meter metric.Meter) error {
+	gauges := make([]metric.Int64ObservableGauge, len(pullPercentiles))
+	instruments := make([]metric.Observable, len(pullPercentiles))
+	quantiles := make([]float64, len(pullPercentiles))
+	for i, p := range pullPercentiles {
+		var err error
+		gauges[i], err = meter.Int64ObservableGauge(p.name, metric.WithDescription(p.description), metric.WithUnit("ms"))
+		if err != nil {
+			return err
+		}
+		instruments[i], quantiles[i] = gauges[i], p.quantile
+	}
+	_, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		h.durations.percentiles(quantiles, func(registry string, values []time.Duration) {
+			attributes := metric.WithAttributes(append(h.clusterAttributes(), h.attrKey("image.registry").String(registry))...)
+			for i, v := range values {
+				o.ObserveInt64(gauges[i], v.Milliseconds(), attributes)
+			}
+		})
+		return nil
+	}, instruments...)
+	return err
+}
@@ -0,0 +1,111 @@
+package pullmetrics
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDurationWindowPercentiles(t *testing.T) {
+	quantiles := []float64{0.5, 0.95, 0.99}
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      []time.Duration
+	}{
+		{
+			name:      "single pull",
+			durations: []time.Duration{3 * time.Second},
+			want:      []time.Duration{3 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:      "nearest rank",
+			durations: []time.Duration{4 * time.Second, 1 * time.Second, 3 * time.Second, 2 * time.Second},
+			want:      []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second},
+		},
+		{
+			name: "hundred pulls",
+			durations: func() []time.Duration {
+				var d []time.Duration
+				for i := 100; i >= 1; i-- {
+					d = append(d, time.Duration(i)*time.Second)
+				}
+				return d
+			}(),
+			want: []time.Duration{50 * time.Second, 95 * time.Second, 99 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newDurationWindow(time.Hour, 10)
+			for _, d := range tt.durations {
+				w.add("docker.io", d)
+			}
+			var got []time.Duration
+			w.percentiles(quantiles, func(registry string, values []time.Duration) { got = values })
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("percentiles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationWindowExpiry(t *testing.T) {
+	const window = 50 * time.Millisecond
+	w := newDurationWindow(window, 10)
+	w.add("docker.io", 10*time.Second)
+	w.add("ghcr.io", 10*time.Second)
+	time.Sleep(2 * window)
+	w.add("docker.io", time.Second)
+
+	got := map[string][]time.Duration{}
+	w.percentiles([]float64{0.99}, func(registry string, values []time.Duration) { got[registry] = values })
+	if len(got) != 1 || !slices.Equal(got["docker.io"], []time.Duration{time.Second}) {
+		t.Errorf("percentiles = %v, want only the recent docker.io pull", got)
+	}
+	if w.size() != 1 {
+		t.Errorf("size = %d, want 1 after forgetting the registry without pulls", w.size())
+	}
+}
+
+func TestDurationWindowLimits(t *testing.T) {
+	w := newDurationWindow(time.Hour, 2)
+	for _, registry := range []string{"docker.io", "ghcr.io", "quay.io"} {
+		w.add(registry, time.Second)
+	}
+	if w.size() != 2 {
+		t.Errorf("size = %d, want pulls from a third registry ignored", w.size())
+	}
+
+	for i := range maxWindowSamples + 10 {
+		w.add("docker.io", time.Duration(i)*time.Millisecond)
+	}
+	w.mu.Lock()
+	samples := w.samples["docker.io"]
+	w.mu.Unlock()
+	if len(samples) != maxWindowSamples || samples[0].duration != 10*time.Millisecond {
+		t.Errorf("kept %d samples starting at %v, want the latest %d", len(samples), samples[0].duration, maxWindowSamples)
+	}
+}
+
+func TestPercentileGauges(t *testing.T) {
+	h, reader := newTestHandler(t, WithPercentiles(time.Hour))
+	for _, d := range []time.Duration{2 * time.Second, 4 * time.Second, 6 * time.Second} {
+		h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage("registry.example.com/app:1.0", d, 1000)))
+	}
+
+	for name, want := range map[string]float64{
+		"k8s.image.pull.duration.p50": 4000,
+		"k8s.image.pull.duration.p95": 6000,
+		"k8s.image.pull.duration.p99": 6000,
+	} {
+		points := collect(t, reader, name)
+		if len(points) != 1 {
+			t.Fatalf("%s has %d data points, want 1", name, len(points))
+		}
+		if points[0].value != want || attributeValue(points[0].attributes, "exported.image.registry") != "registry.example.com" {
+			t.Errorf("%s = %v %v, want %v for registry.example.com", name, points[0].value, points[0].attributes.ToSlice(), want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package pullmetrics
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// sincePodCreated returns the time from the creation of the event's pod to
+// the event, or false if the pod can't be looked up. Node clocks skewed
+// against the API server can make it negative, in which case it's clamped to
+// zero and clamped is true.
+func (h *Handler) sincePodCreated(event *v1.Event) (since time.Duration, clamped, ok bool) {
+	pod, ok := h.lookups.getPod(event.Namespace, event.InvolvedObject.Name)
+	if !ok {
+		return 0, false, false
+	}
+
+	since = eventTime(event).Sub(pod.CreationTimestamp.Time)
+	if since < 0 {
+		return 0, true, true
+	}
+	return since, false, true
+}
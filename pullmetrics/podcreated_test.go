@@ -0,0 +1,53 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSincePodCreated(t *testing.T) {
+	pulled := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name        string
+		created     time.Time
+		pod         string
+		wantSince   int64
+		wantClamped float64
+		wantFound   bool
+	}{
+		{name: "created before the pull", created: pulled.Add(-30 * time.Second), pod: "web-1", wantSince: 30000, wantFound: true},
+		{name: "created at the pull", created: pulled, pod: "web-1", wantSince: 0, wantFound: true},
+		{name: "clock skew", created: pulled.Add(time.Minute), pod: "web-1", wantSince: 0, wantClamped: 1, wantFound: true},
+		{name: "missing pod", created: pulled, pod: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, withFakeLookups(&v1.Pod{ObjectMeta: owned("web-1", tt.created, "", "")}))
+			event := podEvent("", tt.pod, "Pulled", pulledMessage("nginx:1.27", time.Second, 1000))
+			event.FirstTimestamp = metav1.NewTime(pulled)
+			event.LastTimestamp = metav1.NewTime(pulled)
+			h.OnEvent(context.Background(), event)
+
+			points := histogramPoints[int64](t, reader, "k8s.image.pull.since_pod_created")
+			if !tt.wantFound {
+				if len(points) != 0 {
+					t.Errorf("k8s.image.pull.since_pod_created = %+v, want no data points without the pod", points)
+				}
+				return
+			}
+			if len(points) != 1 || points[0].Count != 1 {
+				t.Fatalf("k8s.image.pull.since_pod_created = %+v, want a single measurement", points)
+			}
+			if points[0].Sum != tt.wantSince {
+				t.Errorf("k8s.image.pull.since_pod_created = %dms, want %dms", points[0].Sum, tt.wantSince)
+			}
+			if got := sum(collect(t, reader, "k8s.image.pull.since_pod_created.clamped")); got != tt.wantClamped {
+				t.Errorf("k8s.image.pull.since_pod_created.clamped = %v, want %v", got, tt.wantClamped)
+			}
+		})
+	}
+}
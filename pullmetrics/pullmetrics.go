@@ -0,0 +1,591 @@
+// Package pullmetrics records metrics about container image pulls from the
+// events kubelet emits for them: pull and wait durations, image sizes,
+// failures and pulls in flight, enriched with details of the pod, node and
+// image involved.
+package pullmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Handler turns pod events into metrics. Feed it events with OnEvent and
+// OnUpdate, e.g. from an informer.
+type Handler struct {
+	// config holds the options, replaced as a whole by Reload
+	config   atomic.Pointer[options]
+	reloadMu sync.Mutex
+	lookups  *objectCache
+	// registry looks up the layer counts of pulled images, nil unless
+	// enabled with WithRegistryEnrichment
+	registry *manifestClient
+	// alerts is nil unless enabled with WithAlerts
+	alerts *alerter
+	// nodeEvents is nil unless enabled with WithNodeEvents
+	nodeEvents *nodeEventer
+	// durations holds the pull durations the percentile gauges are
+	// computed from, nil unless enabled with WithPercentiles
+	durations *durationWindow
+
+	durationPullHistogram         metric.Int64Histogram
+	durationPullWaitOnlyHistogram metric.Int64Histogram
+	imageSizeGauge                metric.Int64Gauge
+	sizeGrowthGauge               metric.Int64Gauge
+	eventSpanGauge                metric.Int64Gauge
+	bytesPulledCounter            metric.Int64Counter
+	layerCountGauge               metric.Int64Gauge
+	pullFailureCounter            metric.Int64Counter
+	inFlightCounter               metric.Int64UpDownCounter
+	handlerDurationHistogram      metric.Float64Histogram
+	pullsCounter                  metric.Int64Counter
+	eventsByReasonCounter         metric.Int64Counter
+	waitRatioHistogram            metric.Float64Histogram
+	cachedPullCounter             metric.Int64Counter
+	cacheHitCounter               metric.Int64Counter
+	flappingCounter               metric.Int64Counter
+	repullCounter                 metric.Int64Counter
+	sloViolationCounter           metric.Int64Counter
+	sincePodCreatedHistogram      metric.Int64Histogram
+	sincePodCreatedClampedCounter metric.Int64Counter
+	negativeWaitCounter           metric.Int64Counter
+
+	// pullFailures counts the Failed/BackOff pull events seen per pod and
+	// image, so a later successful pull can report whether it had to be
+	// retried
+	pullFailures  *ttlMap[string, int64]
+	inFlightPulls *ttlMap[string, string]
+	// podPulls holds the pulls recorded per pod in the current flap window
+	podPulls *ttlMap[string, pullWindow]
+	// nodePulls holds the node and image of every pull within the repull
+	// window
+	nodePulls *ttlMap[string, struct{}]
+	// imageSizes holds the last size seen per image tag
+	imageSizes *ttlMap[string, int64]
+
+	eventsSeen    atomic.Int64
+	parseFailures atomic.Int64
+	lastProcessed atomic.Pointer[time.Time]
+}
+
+// New creates the instruments on meter and returns a Handler recording to
+// them.
+func New(meter metric.Meter, opts ...Option) (*Handler, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.cacheMaxEntries <= 0 {
+		return nil, fmt.Errorf("cache max entries must be positive, got %d", o.cacheMaxEntries)
+	}
+	h := &Handler{}
+	h.config.Store(&o)
+	h.lookups = newObjectCache(o)
+
+	buckets := o.durationBuckets
+	h.durationPullHistogram, _ = meter.Int64Histogram(
+		"k8s.image.pull.duration",
+		metric.WithDescription("The duration of image pull."),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(buckets...),
+	)
+	h.durationPullWaitOnlyHistogram, _ = meter.Int64Histogram(
+		"k8s.image.pull_wait_only.duration",
+		metric.WithDescription("The duration of image pull including waiting time."),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(o.waitDurationBuckets...),
+	)
+	h.sincePodCreatedHistogram, _ = meter.Int64Histogram(
+		"k8s.image.pull.since_pod_created",
+		metric.WithDescription("The time from the creation of the pod to its image being pulled."),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(buckets...),
+	)
+	h.sincePodCreatedClampedCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.since_pod_created.clamped",
+		metric.WithDescription("The number of pulls seemingly finished before their pod was created due to clock skew, recorded as zero in k8s.image.pull.since_pod_created."),
+	)
+	h.negativeWaitCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.negative_wait",
+		metric.WithDescription("The number of pulls whose duration including waiting was shorter than the pull duration, recorded with zero wait."),
+	)
+	h.waitRatioHistogram, _ = meter.Float64Histogram(
+		"k8s.image.pull.wait_ratio",
+		metric.WithDescription("The share of the image pull duration spent waiting for other pulls."),
+		metric.WithUnit("1"),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 0.75, 0.9),
+	)
+	h.imageSizeGauge, _ = meter.Int64Gauge(
+		"k8s.image.size",
+		metric.WithDescription("The size of the image in bytes."),
+		metric.WithUnit("bytes"),
+	)
+	h.sizeGrowthGauge, _ = meter.Int64Gauge(
+		"k8s.image.size.growth",
+		metric.WithDescription("The growth in bytes of an image tag's size since its previous pull, recorded when it exceeds -size-growth-threshold."),
+		metric.WithUnit("bytes"),
+	)
+	h.eventSpanGauge, _ = meter.Int64Gauge(
+		"k8s.image.pull.event_span",
+		metric.WithDescription("The time between the first and last occurrence of a Pulled event kubelet coalesced, by bucketed occurrence count."),
+		metric.WithUnit("ms"),
+	)
+	h.bytesPulledCounter, _ = meter.Int64Counter(
+		"k8s.image.bytes_pulled_total",
+		metric.WithDescription("The total size of the images pulled."),
+		metric.WithUnit("bytes"),
+	)
+	h.layerCountGauge, _ = meter.Int64Gauge(
+		"k8s.image.layer.count",
+		metric.WithDescription("The number of layers of the pulled image, as listed in its registry manifest."),
+	)
+	h.pullFailureCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.failures",
+		metric.WithDescription("The number of failed image pulls by failure reason."),
+	)
+	h.inFlightCounter, _ = meter.Int64UpDownCounter(
+		"k8s.image.pull.in_flight",
+		metric.WithDescription("The number of image pulls currently in progress."),
+	)
+	h.cachedPullCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.cached",
+		metric.WithDescription("The number of image pulls faster than -min-pull-duration, left out of the duration histograms."),
+	)
+	h.cacheHitCounter, _ = meter.Int64Counter(
+		"k8s.image.cache_hit",
+		metric.WithDescription("The number of containers started without pulling because their image was already present on the node."),
+	)
+	h.flappingCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.flapping",
+		metric.WithDescription("The number of image pulls of pods exceeding -flap-threshold, recorded only here with reduced attributes."),
+	)
+	h.repullCounter, _ = meter.Int64Counter(
+		"k8s.image.repull",
+		metric.WithDescription("The number of image pulls of an image the same node already pulled within -repull-window."),
+	)
+	h.sloViolationCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.slo_violations",
+		metric.WithDescription("The number of image pulls taking longer than the -slo-thresholds threshold of their registry."),
+	)
+	h.pullsCounter, _ = meter.Int64Counter(
+		"k8s.image.pulls",
+		metric.WithDescription("The number of parsed image pulls, including those not recorded due to -sample-rate."),
+	)
+	h.eventsByReasonCounter, _ = meter.Int64Counter(
+		"k8s.image.pull.events_by_reason",
+		metric.WithDescription("The number of pod events from the source component by reason, before filtering by reason."),
+	)
+	h.handlerDurationHistogram, _ = meter.Float64Histogram(
+		"k8s.image.pull.handler.duration",
+		metric.WithDescription("The time taken to process a Pulled event."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5),
+	)
+
+	h.pullFailures = newTTLMap[string, int64]("pull_failures", o.failureTTL, o.cacheMaxEntries)
+	h.inFlightPulls = h.newInFlightPulls()
+	h.podPulls = newTTLMap[string, pullWindow]("pod_pulls", o.flapWindow, o.cacheMaxEntries)
+	h.nodePulls = newTTLMap[string, struct{}]("node_pulls", o.repullWindow, o.cacheMaxEntries)
+	h.imageSizes = newTTLMap[string, int64]("image_sizes", imageSizesTTL, o.cacheMaxEntries)
+	if o.enrichFromRegistry {
+		var err error
+		h.registry, err = newManifestClient(o.registryConfig, time.Hour, o.cacheMaxEntries)
+		if err != nil {
+			return nil, fmt.Errorf("loading registry config: %w", err)
+		}
+	}
+	if o.alertWebhook != "" {
+		var err error
+		h.alerts, err = newAlerter(o.alertWebhook, o.alertThreshold, o.alertInterval, o.cacheMaxEntries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.nodeEvents {
+		if o.client == nil {
+			return nil, errors.New("node events require WithLookups")
+		}
+		h.nodeEvents = newNodeEventer(o.client, o.nodeEventThreshold, o.nodeEventWindow, o.nodeEventSlowPulls, o.cacheMaxEntries)
+	}
+	if o.percentileWindow > 0 {
+		h.durations = newDurationWindow(o.percentileWindow, o.cacheMaxEntries)
+		if err := h.registerPercentileGauges(meter); err != nil {
+			return nil, err
+		}
+	}
+	if err := registerCacheSizeGauge(meter, h.clusterOption(), h.caches()...); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Handler) caches() []sizedCache {
+	caches := []sizedCache{h.pullFailures, h.inFlightPulls, h.podPulls, h.nodePulls, h.imageSizes}
+	if h.registry != nil {
+		caches = append(caches, h.registry.layers)
+	}
+	if h.alerts != nil {
+		caches = append(caches, h.alerts.alerted)
+	}
+	if h.nodeEvents != nil {
+		caches = append(caches, h.nodeEvents.streaks, h.nodeEvents.reported)
+	}
+	if h.durations != nil {
+		caches = append(caches, h.durations)
+	}
+	return caches
+}
+
+// opts returns the current options. Callers handling an event may observe
+// a Reload between two calls.
+func (h *Handler) opts() *options {
+	return h.config.Load()
+}
+
+// Reload applies opts on top of the current options and atomically replaces
+// them for the events handled from then on, e.g. after a configuration file
+// changed. Only options read while handling events take effect:
+// WithRegistryFilter, WithSLOThresholds, WithRelabelRules, WithSampleRate,
+// WithMaxEventAge, WithMinPullDuration, WithSizeGrowthThreshold,
+// WithNodePoolLabel and WithSnapshotterLabel. Options
+// New creates instruments, caches and clients from, such as buckets, cache
+// sizes and TTLs, lookups, alerts and node events, require a new Handler.
+func (h *Handler) Reload(opts ...Option) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	o := *h.opts()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	h.config.Store(&o)
+}
+
+// Sweep drops expired in-flight pulls, so pulls whose terminal event never
+// arrives stop being counted. Call it periodically.
+func (h *Handler) Sweep() {
+	h.inFlightPulls.sweep()
+}
+
+// Stats are internal counters for troubleshooting.
+type Stats struct {
+	EventsSeen    int64
+	ParseFailures int64
+	// LastProcessed is when a pull was last processed successfully, zero if
+	// none was yet
+	LastProcessed time.Time
+	// CacheSizes holds the number of entries of each correlation cache
+	CacheSizes map[string]int
+}
+
+// Stats returns the current internal counters.
+func (h *Handler) Stats() Stats {
+	s := Stats{
+		EventsSeen:    h.eventsSeen.Load(),
+		ParseFailures: h.parseFailures.Load(),
+		CacheSizes:    map[string]int{},
+	}
+	if t := h.lastProcessed.Load(); t != nil {
+		s.LastProcessed = *t
+	}
+	for _, c := range h.caches() {
+		s.CacheSizes[c.cacheName()] = c.size()
+	}
+	return s
+}
+
+// OnEvent processes a new event.
+func (h *Handler) OnEvent(ctx context.Context, event *v1.Event) {
+	h.handle(ctx, event, "add")
+}
+
+// OnUpdate handles events kubelet coalesced into an existing Event by
+// bumping its Count, e.g. repeated "Back-off pulling image" messages, which
+// would otherwise only be seen once.
+func (h *Handler) OnUpdate(ctx context.Context, oldEvent, newEvent *v1.Event) {
+	if newEvent.Count <= oldEvent.Count {
+		return
+	}
+	h.handle(ctx, newEvent, "update")
+}
+
+// handle processes a kubelet event for a pod. sourceHandler names the
+// informer handler that delivered it ("add" or "update") for debugging.
+func (h *Handler) handle(ctx context.Context, event *v1.Event, sourceHandler string) {
+	h.eventsSeen.Add(1)
+
+	if !h.fromSourceComponent(event) || event.InvolvedObject.Kind != "Pod" {
+		return
+	}
+	if h.tooOld(event) {
+		return
+	}
+	h.eventsByReasonCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("event.reason", event.Reason)), h.clusterOption())
+
+	if event.Reason == "Pulling" {
+		h.startPull(ctx, event)
+		return
+	}
+	if event.Reason == "Failed" || event.Reason == "BackOff" {
+		h.recordPullFailure(ctx, event)
+		return
+	}
+	if event.Reason != "Pulled" {
+		return
+	}
+
+	msg := event.Message
+	if image, ok := parseAlreadyPresentMessage(msg); ok {
+		h.recordCacheHit(ctx, event, image)
+		return
+	}
+	// skip other messages about container images, they don't describe a pull
+	if strings.HasPrefix(msg, "Container image") {
+		log.Println("Skipping event message:", msg)
+		return
+	}
+
+	log.Println("Pod event received:", "source_handler="+sourceHandler, event.Message)
+
+	// measure parsing, enrichment and recording, so slow lookups show up
+	start := time.Now()
+	result := "parse_error"
+	defer func() {
+		h.handlerDurationHistogram.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("result", result)), h.clusterOption())
+	}()
+
+	info, err := ParsePulledMessage(msg, h.opts().messageTemplates)
+	if err != nil {
+		h.parseFailures.Add(1)
+		log.Println("Failed to parse event message:", err)
+		return
+	}
+
+	ref := parseImageRef(info.Image)
+	if !h.registryAllowed(ref.registry) {
+		log.Println("Skipping pull from filtered registry:", info.Image)
+		result = "filtered"
+		return
+	}
+
+	commonAttributes := []attribute.KeyValue{
+		attribute.Int64("observed.timestamp", event.LastTimestamp.UnixMilli()),
+		h.attrKey("namespace").String(event.Namespace),
+		h.attrKey("pod.image").String(info.Image),
+		h.attrKey("host").String(eventHost(event)),
+	}
+
+	if containerType, containerName, ok := parseContainerFieldPath(event.InvolvedObject.FieldPath); ok {
+		commonAttributes = append(commonAttributes, h.attrKey("container.type").String(containerType))
+		// coarse aggregates don't carry it, so spare the pod lookup
+		if h.opts().aggregationMode != AggregationCoarse {
+			if pinned, ok := h.specImagePinned(event.Namespace, event.InvolvedObject.Name, containerType, containerName); ok {
+				commonAttributes = append(commonAttributes, h.attrKey("spec.image_pinned").Bool(pinned))
+			}
+		}
+	}
+
+	commonAttributes = append(commonAttributes,
+		h.attrKey("image.tag").String(ref.tag),
+		h.attrKey("image.pinned").Bool(ref.pinned()),
+	)
+
+	h.finishPull(ctx, event, info.Image)
+
+	// counted before sampling so pull rates stay accurate
+	h.pullsCounter.Add(ctx, 1, metric.WithAttributes(
+		h.attrKey("namespace").String(event.Namespace),
+		h.attrKey("image.registry").String(normalizeRegistry(ref.registry)),
+	), h.clusterOption())
+
+	// the correlation state is kept for every pull, so sampling doesn't hide
+	// the retries, flaps, re-pulls and size growth of the recorded ones
+	priorFailures := h.takePullFailures(event, info.Image)
+	flapping := h.isFlapping(event)
+	// cache hits aren't real pulls, so they can't be re-pulls either
+	repulled := info.PullDuration >= h.opts().minPullDuration && h.isRepull(event, info.Image)
+	// growth is rare and identified without lookups, so it's recorded for
+	// sampled out pulls too
+	if growth, grew := h.sizeGrowth(ref, info.Size); grew {
+		h.record(ctx, func(ctx context.Context) {
+			h.sizeGrowthGauge.Record(ctx, growth, metric.WithAttributes(h.sizeGrowthAttributes(ref)...))
+		})
+	}
+
+	if !h.sampled(event) {
+		result = "sampled_out"
+		return
+	}
+
+	commonAttributes = append(commonAttributes, h.clusterAttributes()...)
+
+	if h.opts().sourceHandlerAttribute {
+		commonAttributes = append(commonAttributes, attribute.String("event.source_handler", sourceHandler))
+	}
+
+	// a successful pull preceded by Failed/BackOff events points at a transient registry issue
+	commonAttributes = append(commonAttributes,
+		h.attrKey("image.retried").Bool(priorFailures > 0),
+		h.attrKey("image.prior_failures").String(priorFailuresBucket(priorFailures)),
+	)
+
+	commonAttributes = append(commonAttributes, h.nodeAttributes(eventHost(event))...)
+	commonAttributes = append(commonAttributes, h.namespaceAttributes(event.Namespace)...)
+
+	// coarse aggregates don't carry the prefix or cause, so spare the pod,
+	// job and ReplicaSet lookups
+	var prefix string
+	if h.opts().aggregationMode != AggregationCoarse {
+		prefix = h.podPrefix(event.Namespace, event.InvolvedObject.Name)
+		commonAttributes = append(commonAttributes, h.attrKey("pull.cause").String(h.pullCause(event.Namespace, event.InvolvedObject.Name)))
+	}
+	if prefix != "" {
+		commonAttributes = append(commonAttributes, h.attrKey("pod.prefix").String(prefix))
+	}
+
+	commonAttributes = h.relabel(commonAttributes)
+	metricAttributes := metric.WithAttributes(commonAttributes...)
+	if h.opts().aggregationMode == AggregationCoarse {
+		metricAttributes = metric.WithAttributes(h.relabel(h.coarseAttributes(event, ref))...)
+	}
+
+	// summed per node and registry for egress and cost analysis. Cache hits
+	// didn't transfer the image.
+	recordBytesPulled := func(ctx context.Context) {
+		if info.PullDuration >= h.opts().minPullDuration {
+			h.bytesPulledCounter.Add(ctx, info.Size, metric.WithAttributes(
+				h.attrKey("host").String(eventHost(event)),
+				h.attrKey("image.registry").String(normalizeRegistry(ref.registry)),
+			), h.clusterOption())
+		}
+	}
+
+	if flapping {
+		log.Println("Pod", event.Namespace+"/"+event.InvolvedObject.Name, "exceeded the flap threshold, recording reduced metrics")
+		h.record(ctx, func(ctx context.Context) {
+			recordBytesPulled(ctx)
+			h.flappingCounter.Add(ctx, 1, metric.WithAttributes(
+				h.attrKey("namespace").String(event.Namespace),
+				h.attrKey("pod.prefix").String(prefix),
+			), h.clusterOption())
+		})
+		result = "parsed"
+		return
+	}
+
+	sinceCreated, clamped, podFound := h.sincePodCreated(event)
+	h.record(ctx, func(ctx context.Context) {
+		// older kubelets don't report the size
+		if info.Size > 0 {
+			h.imageSizeGauge.Record(ctx, info.Size, metricAttributes)
+		}
+		if span, ok := eventSpan(event); ok {
+			h.eventSpanGauge.Record(ctx, span.Milliseconds(), metricAttributes,
+				metric.WithAttributes(attribute.String("event.count", eventCountBucket(event.Count))))
+		}
+		recordBytesPulled(ctx)
+		if podFound {
+			h.sincePodCreatedHistogram.Record(ctx, sinceCreated.Milliseconds(), metricAttributes)
+			if clamped {
+				h.sincePodCreatedClampedCounter.Add(ctx, 1, metricAttributes)
+			}
+		}
+		// pulls this fast are practically cache hits and would only skew the durations
+		if info.PullDuration < h.opts().minPullDuration {
+			h.cachedPullCounter.Add(ctx, 1, metricAttributes)
+			return
+		}
+		if repulled {
+			h.repullCounter.Add(ctx, 1, metricAttributes)
+		}
+		h.durationPullHistogram.Record(ctx, info.PullDuration.Milliseconds(), metricAttributes)
+		if h.durations != nil {
+			h.durations.add(normalizeRegistry(ref.registry), info.PullDuration)
+		}
+		if threshold, ok := h.sloThreshold(ref.registry); ok && info.PullDuration > threshold {
+			h.sloViolationCounter.Add(ctx, 1, metricAttributes)
+		}
+		if info.NegativeWait() {
+			h.negativeWaitCounter.Add(ctx, 1, metricAttributes)
+		}
+		h.durationPullWaitOnlyHistogram.Record(ctx, info.WaitDuration().Milliseconds(), metricAttributes)
+		if ratio, ok := info.WaitRatio(); ok {
+			h.waitRatioHistogram.Record(ctx, ratio, metricAttributes)
+		}
+	})
+
+	if h.registry != nil {
+		layerAttributes := metric.WithAttributes(append(h.clusterAttributes(),
+			h.attrKey("pod.image").String(info.Image),
+			h.attrKey("image.tag").String(ref.tag),
+		)...)
+		h.registry.withLayerCount(info.Image, h.nodeArchitecture(eventHost(event)), func(layers int) {
+			h.record(context.Background(), func(ctx context.Context) {
+				h.layerCountGauge.Record(ctx, int64(layers), layerAttributes)
+			})
+		})
+	}
+
+	// cache hits aren't stuck pulls
+	if h.alerts != nil && info.PullDuration >= h.opts().minPullDuration {
+		h.alerts.check(event, info, h.opts().clusterName)
+	}
+	if h.nodeEvents != nil && info.PullDuration >= h.opts().minPullDuration {
+		h.nodeEvents.check(event, info)
+	}
+
+	if h.opts().records != nil {
+		h.opts().records.send(newPullRecord(event, info, commonAttributes))
+	}
+
+	result = "parsed"
+	now := time.Now()
+	h.lastProcessed.Store(&now)
+	log.Println("Recorded metrics: durationPull:", info.PullDuration.Seconds(), "durationWait:", info.WaitDuration().Seconds(), "imageSize:", info.Size)
+}
+
+// recordCacheHit counts a container whose image was already present on its
+// node, so cache hit ratios can be computed against the recorded pulls.
+func (h *Handler) recordCacheHit(ctx context.Context, event *v1.Event, image string) {
+	ref := parseImageRef(image)
+	if !h.registryAllowed(ref.registry) {
+		return
+	}
+	attributes := h.coarseAttributes(event, ref)
+	if h.opts().aggregationMode != AggregationCoarse {
+		attributes = append(h.clusterAttributes(),
+			h.attrKey("namespace").String(event.Namespace),
+			h.attrKey("pod.image").String(image),
+			h.attrKey("image.registry").String(normalizeRegistry(ref.registry)),
+			h.attrKey("host").String(eventHost(event)),
+		)
+	}
+	metricAttributes := metric.WithAttributes(h.relabel(attributes)...)
+	h.record(ctx, func(ctx context.Context) {
+		h.cacheHitCounter.Add(ctx, 1, metricAttributes)
+	})
+}
+
+// coarseAttributes returns the attributes of a pull recorded with
+// AggregationCoarse: only its cluster, namespace, registry and node pool.
+func (h *Handler) coarseAttributes(event *v1.Event, ref imageRef) []attribute.KeyValue {
+	attributes := append(h.clusterAttributes(),
+		h.attrKey("namespace").String(event.Namespace),
+		h.attrKey("image.registry").String(normalizeRegistry(ref.registry)),
+	)
+	if node, ok := h.lookups.getNode(eventHost(event)); ok {
+		if pool := h.nodePool(node); pool != "" {
+			attributes = append(attributes, h.attrKey("node.pool").String(pool))
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,497 @@
+package pullmetrics
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestHandler returns a Handler without lookups recording to a manual
+// reader.
+func newTestHandler(t *testing.T, opts ...Option) (*Handler, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	h, err := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, reader
+}
+
+// podEvent returns a kubelet event about the web container of pod in the
+// default namespace, emitted by node-1.
+func podEvent(uid types.UID, pod, reason, message string) *v1.Event {
+	now := metav1.Now()
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: pod + "." + string(uid), Namespace: metav1.NamespaceDefault, UID: uid},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: metav1.NamespaceDefault,
+			Name:      pod,
+			FieldPath: "spec.containers{web}",
+		},
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: "kubelet", Host: "node-1"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
+
+// pulledMessage returns the message of a Pulled event for image.
+func pulledMessage(image string, d time.Duration, size int64) string {
+	return fmt.Sprintf("Successfully pulled image %q in %s (%s including waiting). Image size: %d bytes.", image, d, d, size)
+}
+
+// dataPoint is a collected data point: the value of a sum or gauge, or the
+// count of a histogram.
+type dataPoint struct {
+	attributes attribute.Set
+	value      float64
+}
+
+// collect returns the data points of the metric named name.
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) []dataPoint {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var points []dataPoint
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, float64(dp.Value)})
+				}
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, dp.Value})
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, float64(dp.Value)})
+				}
+			case metricdata.Gauge[float64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, dp.Value})
+				}
+			case metricdata.Histogram[int64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, float64(dp.Count)})
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					points = append(points, dataPoint{dp.Attributes, float64(dp.Count)})
+				}
+			default:
+				t.Fatalf("unexpected data %T of %s", data, name)
+			}
+		}
+	}
+	return points
+}
+
+// readerFunc returns the data points of the metric named name.
+type readerFunc func(name string) []dataPoint
+
+// histogramPoints returns the histogram data points of the metric named name.
+func histogramPoints[N int64 | float64](t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.HistogramDataPoint[N] {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var points []metricdata.HistogramDataPoint[N]
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			data, ok := m.Data.(metricdata.Histogram[N])
+			if !ok {
+				t.Fatalf("unexpected data %T of %s", m.Data, name)
+			}
+			points = append(points, data.DataPoints...)
+		}
+	}
+	return points
+}
+
+// sum adds up the values of points.
+func sum(points []dataPoint) float64 {
+	var total float64
+	for _, p := range points {
+		total += p.value
+	}
+	return total
+}
+
+// attributeValue returns the value of key in set as a string, empty if it's
+// missing.
+func attributeValue(set attribute.Set, key string) string {
+	v, ok := set.Value(attribute.Key(key))
+	if !ok {
+		return ""
+	}
+	return v.Emit()
+}
+
+func TestReload(t *testing.T) {
+	h, reader := newTestHandler(t, WithAttributePrefix("k8s."), WithRegistryFilter(nil, []string{"registry.k8s.io"}))
+	pull := func(image string) {
+		h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)))
+	}
+	registries := func() map[string]float64 {
+		got := map[string]float64{}
+		for _, p := range collect(t, reader, "k8s.image.pulls") {
+			got[attributeValue(p.attributes, "k8s.image.registry")] += p.value
+		}
+		return got
+	}
+
+	pull("registry.k8s.io/pause:3.9")
+	pull("ghcr.io/org/app:1")
+	h.Reload(WithRegistryFilter(nil, []string{"ghcr.io"}), WithMinPullDuration(5*time.Second))
+	pull("registry.k8s.io/pause:3.9")
+	pull("ghcr.io/org/app:1")
+
+	if got := registries(); len(got) != 2 || got["ghcr.io"] != 1 || got["registry.k8s.io"] != 1 {
+		t.Errorf("k8s.image.pulls by registry = %v, want one pull of each registry", got)
+	}
+	// the reloaded minimum applies, the prefix set by New is kept
+	if got := sum(collect(t, reader, "k8s.image.pull.cached")); got != 1 {
+		t.Errorf("k8s.image.pull.cached = %v, want the pull after reloading", got)
+	}
+	if got := h.opts().attributePrefix; got != "k8s." {
+		t.Errorf("attribute prefix after reload = %q, want k8s.", got)
+	}
+}
+
+func TestHandlerDuration(t *testing.T) {
+	h, reader := newTestHandler(t, WithRegistryFilter(nil, []string{"registry.k8s.io"}))
+	for _, msg := range []string{
+		pulledMessage("nginx:1.27", 2*time.Second, 1000),
+		pulledMessage("nginx:1.28", 2*time.Second, 1000),
+		pulledMessage("registry.k8s.io/pause:3.9", 2*time.Second, 1000),
+		`Successfully pulled image "nginx:1.27" in a while`,
+		// not a pull, so not timed
+		`Container image "nginx:1.27" already present on machine`,
+	} {
+		h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", msg))
+	}
+	h.OnEvent(context.Background(), podEvent("", "web-1", "Pulling", `Pulling image "nginx:1.27"`))
+
+	got := map[string]float64{}
+	for _, p := range collect(t, reader, "k8s.image.pull.handler.duration") {
+		got[attributeValue(p.attributes, "result")] += p.value
+	}
+	want := map[string]float64{"parsed": 2, "filtered": 1, "parse_error": 1}
+	if len(got) != len(want) || got["parsed"] != 2 || got["filtered"] != 1 || got["parse_error"] != 1 {
+		t.Errorf("k8s.image.pull.handler.duration counts by result = %v, want %v", got, want)
+	}
+}
+
+func TestMinPullDuration(t *testing.T) {
+	tests := []struct {
+		name         string
+		duration     time.Duration
+		wantCached   float64
+		wantDuration int
+	}{
+		{name: "below the threshold", duration: 200 * time.Millisecond, wantCached: 1},
+		{name: "at the threshold", duration: time.Second, wantDuration: 1},
+		{name: "above the threshold", duration: 5 * time.Second, wantDuration: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithMinPullDuration(time.Second))
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", tt.duration, 1000)))
+
+			if got := sum(collect(t, reader, "k8s.image.pull.cached")); got != tt.wantCached {
+				t.Errorf("k8s.image.pull.cached = %v, want %v", got, tt.wantCached)
+			}
+			if got := len(collect(t, reader, "k8s.image.pull.duration")); got != tt.wantDuration {
+				t.Errorf("k8s.image.pull.duration has %d data points, want %d", got, tt.wantDuration)
+			}
+			// cache hits didn't transfer the image
+			if got := sum(collect(t, reader, "k8s.image.bytes_pulled_total")); got != float64(1000*tt.wantDuration) {
+				t.Errorf("k8s.image.bytes_pulled_total = %v, want %d", got, 1000*tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestWaitRatio(t *testing.T) {
+	tests := []struct {
+		name      string
+		pull      time.Duration
+		total     time.Duration
+		wantRatio float64
+	}{
+		{name: "mostly waiting", pull: time.Second, total: 10 * time.Second, wantRatio: 0.9},
+		{name: "negligible wait", pull: 10 * time.Second, total: 10*time.Second + 10*time.Millisecond, wantRatio: 0.001},
+		{name: "no wait", pull: 10 * time.Second, total: 10 * time.Second, wantRatio: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t)
+			msg := fmt.Sprintf("Successfully pulled image %q in %s (%s including waiting). Image size: 1000 bytes.", "nginx:1.27", tt.pull, tt.total)
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", msg))
+
+			points := histogramPoints[float64](t, reader, "k8s.image.pull.wait_ratio")
+			if len(points) != 1 || points[0].Count != 1 {
+				t.Fatalf("k8s.image.pull.wait_ratio = %+v, want a single measurement", points)
+			}
+			if got := points[0].Sum; math.Abs(got-tt.wantRatio) > 1e-6 {
+				t.Errorf("k8s.image.pull.wait_ratio = %v, want %v", got, tt.wantRatio)
+			}
+		})
+	}
+}
+
+func TestAggregationCoarse(t *testing.T) {
+	lookups := withFakeLookups(
+		&v1.Pod{ObjectMeta: owned("web-5d8f7c9b4-x2x7k", time.Now(), "ReplicaSet", "web-5d8f7c9b4")},
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"karpenter.sh/nodepool": "general"}},
+			Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KubeletVersion: "v1.32.0"}},
+		},
+	)
+	tests := []struct {
+		mode        AggregationMode
+		wantKeys    []string
+		droppedKeys []string
+	}{
+		{
+			mode:     AggregationDetailed,
+			wantKeys: []string{"exported.namespace", "exported.node.pool", "exported.host", "exported.pod.image", "exported.pod.prefix", "exported.image.tag", "exported.kubelet.version", "exported.pull.cause"},
+		},
+		{
+			mode:        AggregationCoarse,
+			wantKeys:    []string{"exported.namespace", "exported.image.registry", "exported.node.pool"},
+			droppedKeys: []string{"exported.host", "exported.pod.image", "exported.pod.prefix", "exported.image.tag", "exported.kubelet.version", "exported.pull.cause", "exported.container.type", "exported.image.retried", "observed.timestamp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			h, reader := newTestHandler(t, lookups, WithAggregationMode(tt.mode))
+			h.OnEvent(context.Background(), podEvent("", "web-5d8f7c9b4-x2x7k", "Pulled", pulledMessage("ghcr.io/acme/web:1.4", time.Second, 1000)))
+
+			points := collect(t, reader, "k8s.image.pull.duration")
+			if len(points) != 1 {
+				t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(points))
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := points[0].attributes.Value(attribute.Key(key)); !ok {
+					t.Errorf("attribute %s is missing from %v", key, points[0].attributes.ToSlice())
+				}
+			}
+			for _, key := range tt.droppedKeys {
+				if v, ok := points[0].attributes.Value(attribute.Key(key)); ok {
+					t.Errorf("attribute %s = %q, want it dropped", key, v.Emit())
+				}
+			}
+			if tt.mode == AggregationCoarse && points[0].attributes.Len() != len(tt.wantKeys) {
+				t.Errorf("attributes = %v, want only %v", points[0].attributes.ToSlice(), tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestBytesPulledPerNodeAndRegistry(t *testing.T) {
+	h, reader := newTestHandler(t)
+	pulls := []struct {
+		node  string
+		image string
+		size  int64
+	}{
+		{"node-1", "nginx:1.27", 1000},
+		{"node-1", "docker.io/library/nginx:1.28", 500},
+		{"node-1", "ghcr.io/acme/web:1.4", 200},
+		{"node-2", "nginx:1.27", 300},
+	}
+	for _, p := range pulls {
+		event := podEvent("", "web-1", "Pulled", pulledMessage(p.image, time.Second, p.size))
+		event.Source.Host = p.node
+		h.OnEvent(context.Background(), event)
+	}
+
+	got := make(map[string]float64)
+	for _, p := range collect(t, reader, "k8s.image.bytes_pulled_total") {
+		got[attributeValue(p.attributes, "exported.host")+" "+attributeValue(p.attributes, "exported.image.registry")] = p.value
+	}
+	want := map[string]float64{
+		"node-1 docker.io": 1500,
+		"node-1 ghcr.io":   200,
+		"node-2 docker.io": 300,
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("k8s.image.bytes_pulled_total = %v, want %v", got, want)
+	}
+}
+
+func TestWaitOnlyBuckets(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantWait     []float64
+		wantDuration []float64
+	}{
+		{name: "defaults", wantWait: DefaultWaitDurationBuckets, wantDuration: DefaultDurationBuckets},
+		{name: "custom wait buckets", opts: []Option{WithWaitDurationBuckets([]float64{100, 500})}, wantWait: []float64{100, 500}, wantDuration: DefaultDurationBuckets},
+		{
+			name:         "custom duration buckets",
+			opts:         []Option{WithDurationBuckets([]float64{1000, 60000})},
+			wantWait:     DefaultWaitDurationBuckets,
+			wantDuration: []float64{1000, 60000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, tt.opts...)
+			msg := fmt.Sprintf("Successfully pulled image %q in %s (%s including waiting). Image size: 1000 bytes.", "nginx:1.27", time.Second, 1250*time.Millisecond)
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", msg))
+
+			wait := histogramPoints[int64](t, reader, "k8s.image.pull_wait_only.duration")
+			if len(wait) != 1 {
+				t.Fatalf("k8s.image.pull_wait_only.duration has %d data points, want 1", len(wait))
+			}
+			if !slices.Equal(wait[0].Bounds, tt.wantWait) {
+				t.Errorf("k8s.image.pull_wait_only.duration bounds = %v, want %v", wait[0].Bounds, tt.wantWait)
+			}
+			if wait[0].Sum != 250 {
+				t.Errorf("k8s.image.pull_wait_only.duration = %dms, want 250ms", wait[0].Sum)
+			}
+			duration := histogramPoints[int64](t, reader, "k8s.image.pull.duration")
+			if len(duration) != 1 || !slices.Equal(duration[0].Bounds, tt.wantDuration) {
+				t.Errorf("k8s.image.pull.duration = %+v, want bounds %v", duration, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestNegativeWait(t *testing.T) {
+	tests := []struct {
+		name         string
+		pull         time.Duration
+		total        time.Duration
+		wantNegative float64
+		wantWait     int64
+	}{
+		{name: "waited", pull: time.Second, total: 1500 * time.Millisecond, wantWait: 500},
+		{name: "no wait", pull: time.Second, total: time.Second},
+		{name: "total shorter than the pull", pull: 2 * time.Second, total: 1500 * time.Millisecond, wantNegative: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t)
+			msg := fmt.Sprintf("Successfully pulled image %q in %s (%s including waiting). Image size: 1000 bytes.", "nginx:1.27", tt.pull, tt.total)
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", msg))
+
+			if got := sum(collect(t, reader, "k8s.image.pull.negative_wait")); got != tt.wantNegative {
+				t.Errorf("k8s.image.pull.negative_wait = %v, want %v", got, tt.wantNegative)
+			}
+			wait := histogramPoints[int64](t, reader, "k8s.image.pull_wait_only.duration")
+			if len(wait) != 1 || wait[0].Count != 1 {
+				t.Fatalf("k8s.image.pull_wait_only.duration = %+v, want a single measurement", wait)
+			}
+			if wait[0].Sum != tt.wantWait {
+				t.Errorf("k8s.image.pull_wait_only.duration = %dms, want %dms", wait[0].Sum, tt.wantWait)
+			}
+			if minimum, ok := wait[0].Min.Value(); ok && minimum < 0 {
+				t.Errorf("k8s.image.pull_wait_only.duration min = %dms, want it clamped to 0", minimum)
+			}
+		})
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		msg       string
+		wantHits  float64
+		wantImage string
+	}{
+		{name: "already present", msg: `Container image "nginx:1.27" already present on machine`, wantHits: 1, wantImage: "nginx:1.27"},
+		{name: "already present with digest", msg: `Container image "ghcr.io/acme/web@sha256:9b2a" already present on machine and container will be started`, wantHits: 1, wantImage: "ghcr.io/acme/web@sha256:9b2a"},
+		{name: "registry filtered", opts: []Option{WithRegistryFilter([]string{"ghcr.io"}, nil)}, msg: `Container image "nginx:1.27" already present on machine`},
+		{name: "pulled", msg: pulledMessage("nginx:1.27", time.Second, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, tt.opts...)
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", tt.msg))
+
+			hits := collect(t, reader, "k8s.image.cache_hit")
+			if got := sum(hits); got != tt.wantHits {
+				t.Fatalf("k8s.image.cache_hit = %v, want %v", got, tt.wantHits)
+			}
+			if tt.wantHits == 0 {
+				return
+			}
+			if got := attributeValue(hits[0].attributes, "exported.pod.image"); got != tt.wantImage {
+				t.Errorf("exported.pod.image = %q, want %q", got, tt.wantImage)
+			}
+			if got := attributeValue(hits[0].attributes, "exported.host"); got != "node-1" {
+				t.Errorf("exported.host = %q, want node-1", got)
+			}
+			// a cache hit is neither a pull nor a parse error
+			if got := sum(collect(t, reader, "k8s.image.pulls")); got != 0 {
+				t.Errorf("k8s.image.pulls = %v, want 0", got)
+			}
+			for _, p := range collect(t, reader, "k8s.image.pull.handler.duration") {
+				if result := attributeValue(p.attributes, "result"); result == "parse_error" {
+					t.Errorf("cache hit recorded as a parse error")
+				}
+			}
+		})
+	}
+}
+
+func TestEventsByReason(t *testing.T) {
+	h, reader := newTestHandler(t)
+	events := []*v1.Event{
+		podEvent("", "web-1", "Pulling", `Pulling image "nginx:1.27"`),
+		podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000)),
+		podEvent("", "web-2", "Pulling", `Pulling image "nginx:1.28"`),
+		podEvent("", "web-2", "Failed", `Failed to pull image "nginx:1.28": not found`),
+		podEvent("", "web-2", "BackOff", `Back-off pulling image "nginx:1.28"`),
+		podEvent("", "web-3", "Pulled", `Container image "nginx:1.27" already present on machine`),
+		podEvent("", "web-3", "Started", "Started container web"),
+	}
+	// events of other components and objects aren't counted
+	scheduled := podEvent("", "web-4", "Scheduled", "Successfully assigned default/web-4 to node-1")
+	scheduled.Source.Component = "default-scheduler"
+	node := podEvent("", "node-1", "NodeReady", "Node node-1 status is now: NodeReady")
+	node.InvolvedObject.Kind = "Node"
+	for _, event := range append(events, scheduled, node) {
+		h.OnEvent(context.Background(), event)
+	}
+
+	got := make(map[string]float64)
+	for _, p := range collect(t, reader, "k8s.image.pull.events_by_reason") {
+		got[attributeValue(p.attributes, "event.reason")] = p.value
+	}
+	want := map[string]float64{"Pulling": 2, "Pulled": 2, "Failed": 1, "BackOff": 1, "Started": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("k8s.image.pull.events_by_reason = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package pullmetrics
+
+import (
+	"context"
+	"log"
+)
+
+// record runs fn, which records metrics, without letting it block the
+// caller for longer than the record timeout. Recording is skipped entirely
+// once ctx is cancelled, i.e. after shutdown started.
+func (h *Handler) record(ctx context.Context, fn func(ctx context.Context)) {
+	if ctx.Err() != nil {
+		log.Println("Skipping recording metrics:", ctx.Err())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.opts().recordTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Abandoned recording metrics:", ctx.Err())
+	}
+}
@@ -0,0 +1,110 @@
+package pullmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	v1 "k8s.io/api/core/v1"
+)
+
+// pullRecord is the JSON document written to the records sink for each pull.
+type pullRecord struct {
+	Time           time.Time      `json:"time"`
+	Image          string         `json:"image"`
+	PullDurationMs int64          `json:"pull_duration_ms"`
+	WaitDurationMs int64          `json:"wait_duration_ms"`
+	SizeBytes      int64          `json:"size_bytes"`
+	Attributes     map[string]any `json:"attributes"`
+}
+
+func newPullRecord(event *v1.Event, info PullInfo, attributes []attribute.KeyValue) pullRecord {
+	r := pullRecord{
+		Time:           event.LastTimestamp.Time,
+		Image:          info.Image,
+		PullDurationMs: info.PullDuration.Milliseconds(),
+		WaitDurationMs: info.WaitDuration().Milliseconds(),
+		SizeBytes:      info.Size,
+		Attributes:     make(map[string]any, len(attributes)),
+	}
+	for _, kv := range attributes {
+		r.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return r
+}
+
+// RecordSink writes pull records as JSON lines to stdout or POSTs them to a
+// webhook. Writes happen on a separate goroutine behind a bounded queue, so a
+// slow or failing sink drops records instead of delaying metric recording.
+type RecordSink struct {
+	queue  chan pullRecord
+	write  func([]byte) error
+	client *http.Client
+}
+
+// NewRecordSink returns the sink for target: "stdout" or an http(s) URL. It
+// returns nil for "none" or "".
+func NewRecordSink(target string) (*RecordSink, error) {
+	s := &RecordSink{queue: make(chan pullRecord, 1000)}
+	switch target {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		s.write = func(b []byte) error {
+			_, err := os.Stdout.Write(append(b, '\n'))
+			return err
+		}
+	default:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid records sink %q, expected none, stdout or an http(s) URL", target)
+		}
+		s.client = &http.Client{Timeout: 10 * time.Second}
+		s.write = func(b []byte) error { return s.post(target, b) }
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// send queues r for writing, dropping it if the queue is full.
+func (s *RecordSink) send(r pullRecord) {
+	select {
+	case s.queue <- r:
+	default:
+		log.Println("Records sink queue full, dropping record for", r.Image)
+	}
+}
+
+func (s *RecordSink) run() {
+	for r := range s.queue {
+		b, err := json.Marshal(r)
+		if err != nil {
+			log.Println("Failed to marshal pull record:", err)
+			continue
+		}
+		if err := s.write(b); err != nil {
+			log.Println("Failed to write pull record:", err)
+		}
+	}
+}
+
+func (s *RecordSink) post(target string, b []byte) error {
+	resp, err := s.client.Post(target, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("records sink returned %s", resp.Status)
+	}
+	return nil
+}
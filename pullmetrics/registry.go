@@ -0,0 +1,241 @@
+package pullmetrics
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// manifestClient fetches image manifests from registries over the
+// distribution API, authenticating with basic credentials from a Docker
+// config file or anonymous bearer tokens. Layer counts are cached per image
+// reference and architecture so each image is only looked up once per ttl
+// and node architecture.
+type manifestClient struct {
+	http *http.Client
+	// auths maps registry hosts to base64 encoded "user:password"
+	auths  map[string]string
+	layers *ttlMap[string, int]
+	// sem bounds the number of concurrent registry requests
+	sem chan struct{}
+}
+
+func newManifestClient(configFile string, ttl time.Duration, maxEntries int) (*manifestClient, error) {
+	c := &manifestClient{
+		http:   &http.Client{Timeout: 10 * time.Second},
+		auths:  map[string]string{},
+		layers: newTTLMap[string, int]("layer_counts", ttl, maxEntries),
+		sem:    make(chan struct{}, 4),
+	}
+	if configFile == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", configFile, err)
+	}
+	for host, auth := range config.Auths {
+		// keys may be full URLs such as https://index.docker.io/v1/
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		if auth.Auth == "" {
+			auth.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		}
+		c.auths[normalizeRegistry(host)] = auth.Auth
+	}
+	return c, nil
+}
+
+// withLayerCount calls record with the layer count of image, in the
+// background unless its manifest is cached. Lookups are dropped while the
+// registry concurrency limit is reached.
+func (c *manifestClient) withLayerCount(image, arch string, record func(layers int)) {
+	// multi-platform images have different layers per architecture
+	key := image + "|" + arch
+	if layers, ok := c.layers.get(key); ok {
+		record(layers)
+		return
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-c.sem }()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		layers, err := c.layerCount(ctx, parseImageRef(image), arch)
+		if err != nil {
+			log.Println("Failed to fetch manifest of", image+":", err)
+			return
+		}
+		c.layers.update(key, func(int, bool) int { return layers })
+		record(layers)
+	}()
+}
+
+// layerCount returns the number of layers of ref. For multi-platform images
+// the linux manifest for arch is used.
+func (c *manifestClient) layerCount(ctx context.Context, ref imageRef, arch string) (int, error) {
+	reference := ref.digest
+	if reference == "" {
+		reference = ref.tag
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+
+	var manifest struct {
+		MediaType string            `json:"mediaType"`
+		Layers    []json.RawMessage `json:"layers"`
+		Manifests []struct {
+			Digest   string `json:"digest"`
+			Platform struct {
+				OS           string `json:"os"`
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := c.getManifest(ctx, ref, reference, &manifest); err != nil {
+		return 0, err
+	}
+	if manifest.MediaType != mediaTypeDockerManifestList && manifest.MediaType != mediaTypeOCIIndex && len(manifest.Manifests) == 0 {
+		return len(manifest.Layers), nil
+	}
+
+	for _, m := range manifest.Manifests {
+		if m.Platform.OS == "linux" && m.Platform.Architecture == arch {
+			return c.layerCount(ctx, imageRef{registry: ref.registry, repository: ref.repository, digest: m.Digest}, arch)
+		}
+	}
+	return 0, fmt.Errorf("no linux/%s manifest", arch)
+}
+
+func (c *manifestClient) getManifest(ctx context.Context, ref imageRef, reference string, v any) error {
+	host := ref.registry
+	if normalizeRegistry(host) == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, ref.repository, reference)
+
+	auth := ""
+	if creds, ok := c.auths[normalizeRegistry(ref.registry)]; ok {
+		auth = "Basic " + creds
+	}
+	resp, err := c.get(ctx, url, auth)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.token(ctx, challenge, c.auths[normalizeRegistry(ref.registry)])
+		if err != nil {
+			return err
+		}
+		if resp, err = c.get(ctx, url, "Bearer "+token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(v)
+}
+
+func (c *manifestClient) get(ctx context.Context, url, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join([]string{mediaTypeOCIIndex, mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeDockerManifest}, ", "))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.http.Do(req)
+}
+
+// extracts the parameters of a `Bearer realm="...",service="...",scope="..."`
+// authentication challenge
+var challengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// token requests a bearer token as described by a registry's authentication
+// challenge, with basic credentials if any are configured for the registry.
+func (c *manifestClient) token(ctx context.Context, challenge, creds string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	values := map[string]string{}
+	for _, m := range challengeParamRe.FindAllStringSubmatch(params, -1) {
+		values[m[1]] = m[2]
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("authentication challenge without realm %q", challenge)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, values["realm"], nil)
+	if err != nil {
+		return "", err
+	}
+	q := req.URL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			q.Set(key, values[key])
+		}
+	}
+	req.URL.RawQuery = q.Encode()
+	if creds != "" {
+		req.Header.Set("Authorization", "Basic "+creds)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("requesting token: unexpected status %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
@@ -0,0 +1,175 @@
+package pullmetrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRegistry serves the manifests of the repository "app" keyed by
+// reference. With token set, manifest requests need it as bearer token,
+// which is handed out by /token for the basic credentials "user:secret".
+func newTestRegistry(t *testing.T, token string, manifests map[string]any) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" || r.URL.Query().Get("scope") != "repository:app:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": token})
+			return
+		}
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test",scope="repository:app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		manifest, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(manifest)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestManifestClientLayerCount(t *testing.T) {
+	layers := func(n int) []map[string]string { return make([]map[string]string, n) }
+	manifests := map[string]any{
+		"1.0": map[string]any{"mediaType": mediaTypeDockerManifest, "layers": layers(3)},
+		"multi": map[string]any{
+			"mediaType": mediaTypeOCIIndex,
+			"manifests": []map[string]any{
+				{"digest": "sha256:arm", "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+				{"digest": "sha256:amd", "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			},
+		},
+		"sha256:arm": map[string]any{"mediaType": mediaTypeOCIManifest, "layers": layers(5)},
+		"sha256:amd": map[string]any{"mediaType": mediaTypeOCIManifest, "layers": layers(7)},
+		"latest":     map[string]any{"mediaType": mediaTypeOCIManifest, "layers": layers(1)},
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		image   string
+		arch    string
+		want    int
+		wantErr bool
+	}{
+		{name: "manifest", image: "app:1.0", arch: "amd64", want: 3},
+		{name: "index", image: "app:multi", arch: "arm64", want: 5},
+		{name: "index other architecture", image: "app:multi", arch: "amd64", want: 7},
+		{name: "index without architecture", image: "app:multi", arch: "s390x", wantErr: true},
+		{name: "digest", image: "app@sha256:amd", arch: "amd64", want: 7},
+		{name: "untagged", image: "app", arch: "amd64", want: 1},
+		{name: "unknown tag", image: "app:2.0", arch: "amd64", wantErr: true},
+		{name: "bearer token", token: "t0ken", image: "app:1.0", arch: "amd64", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestRegistry(t, tt.token, manifests)
+			host := strings.TrimPrefix(server.URL, "https://")
+			config := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(config, []byte(`{"auths":{"https://`+host+`/v1/":{"username":"user","password":"secret"}}}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c, err := newManifestClient(config, time.Hour, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.http = server.Client()
+
+			got, err := c.layerCount(context.Background(), parseImageRef(host+"/"+tt.image), tt.arch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("layerCount(%q) error = %v, want error %v", tt.image, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("layerCount(%q) = %d, want %d", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestClientCachesLayerCounts(t *testing.T) {
+	var requests int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(map[string]any{"mediaType": mediaTypeDockerManifest, "layers": make([]struct{}, 2)})
+	}))
+	defer server.Close()
+	c, err := newManifestClient("", time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.http = server.Client()
+
+	image := strings.TrimPrefix(server.URL, "https://") + "/app:1.0"
+	for range 2 {
+		done := make(chan int, 1)
+		c.withLayerCount(image, "amd64", func(layers int) { done <- layers })
+		select {
+		case layers := <-done:
+			if layers != 2 {
+				t.Errorf("layers = %d, want 2", layers)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("layer count wasn't recorded")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("registry got %d requests, want 1", requests)
+	}
+}
+
+func TestManifestClientCachesLayerCountsPerArchitecture(t *testing.T) {
+	server := newTestRegistry(t, "", map[string]any{
+		"multi": map[string]any{
+			"mediaType": mediaTypeOCIIndex,
+			"manifests": []map[string]any{
+				{"digest": "sha256:arm", "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+				{"digest": "sha256:amd", "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+			},
+		},
+		"sha256:arm": map[string]any{"mediaType": mediaTypeOCIManifest, "layers": make([]struct{}, 5)},
+		"sha256:amd": map[string]any{"mediaType": mediaTypeOCIManifest, "layers": make([]struct{}, 7)},
+	})
+	c, err := newManifestClient("", time.Hour, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.http = server.Client()
+
+	image := strings.TrimPrefix(server.URL, "https://") + "/app:multi"
+	for _, tt := range []struct {
+		arch string
+		want int
+	}{
+		{"amd64", 7},
+		{"arm64", 5},
+		// cached
+		{"amd64", 7},
+		{"arm64", 5},
+	} {
+		done := make(chan int, 1)
+		c.withLayerCount(image, tt.arch, func(layers int) { done <- layers })
+		select {
+		case layers := <-done:
+			if layers != tt.want {
+				t.Errorf("layers on %s = %d, want %d", tt.arch, layers, tt.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("layer count on %s wasn't recorded", tt.arch)
+		}
+	}
+}
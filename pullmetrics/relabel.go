@@ -0,0 +1,70 @@
+package pullmetrics
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RelabelRule rewrites an attribute of recorded pulls, like a Prometheus
+// relabel_config with the replace action.
+type RelabelRule struct {
+	// Source is the attribute whose value is matched
+	Source string
+	// Regex must match the whole value of Source for the rule to apply
+	Regex *regexp.Regexp
+	// Replacement is the new value of Target, which may refer to capture
+	// groups of Regex as $1 or ${name}
+	Replacement string
+	// Target is the attribute set to Replacement, added if missing
+	Target string
+}
+
+// ParseRelabelRule compiles a rule setting target to replacement when the
+// value of source matches regex. regex is anchored at both ends, and an
+// empty target rewrites source itself.
+func ParseRelabelRule(source, regex, replacement, target string) (RelabelRule, error) {
+	if source == "" {
+		return RelabelRule{}, fmt.Errorf("relabel rule: source is required")
+	}
+	// compile it unanchored first so errors quote the regex as written
+	if _, err := regexp.Compile(regex); err != nil {
+		return RelabelRule{}, fmt.Errorf("relabel rule for %q: %w", source, err)
+	}
+	re := regexp.MustCompile("^(?:" + regex + ")$")
+	if target == "" {
+		target = source
+	}
+	return RelabelRule{Source: source, Regex: re, Replacement: replacement, Target: target}, nil
+}
+
+// relabel applies the relabel rules in order to attributes, each seeing the
+// result of the previous ones. Rewritten values are strings.
+func (h *Handler) relabel(attributes []attribute.KeyValue) []attribute.KeyValue {
+	for _, rule := range h.opts().relabelRules {
+		i := attributeIndex(attributes, rule.Source)
+		if i < 0 {
+			continue
+		}
+		value := attributes[i].Value.Emit()
+		match := rule.Regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			continue
+		}
+		kv := attribute.String(rule.Target, string(rule.Regex.ExpandString(nil, rule.Replacement, value, match)))
+		if j := attributeIndex(attributes, rule.Target); j >= 0 {
+			attributes[j] = kv
+		} else {
+			attributes = append(attributes, kv)
+		}
+	}
+	return attributes
+}
+
+func attributeIndex(attributes []attribute.KeyValue, key string) int {
+	return slices.IndexFunc(attributes, func(kv attribute.KeyValue) bool {
+		return string(kv.Key) == key
+	})
+}
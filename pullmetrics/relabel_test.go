@@ -0,0 +1,131 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func mustParseRelabelRule(t *testing.T, source, regex, replacement, target string) RelabelRule {
+	t.Helper()
+	rule, err := ParseRelabelRule(source, regex, replacement, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestRelabel(t *testing.T) {
+	attributes := func() []attribute.KeyValue {
+		return []attribute.KeyValue{
+			attribute.String("exported.image.tag", "3f9c2a1"),
+			attribute.String("exported.host", "ip-10-1-2-3"),
+			attribute.Bool("exported.image.retried", false),
+		}
+	}
+	tests := []struct {
+		name  string
+		rules func(t *testing.T) []RelabelRule
+		want  []attribute.KeyValue
+	}{
+		{
+			name: "replaces a matching value",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{mustParseRelabelRule(t, "exported.image.tag", "[0-9a-f]{7,40}", "sha", "")}
+			},
+			want: []attribute.KeyValue{
+				attribute.String("exported.image.tag", "sha"),
+				attribute.String("exported.host", "ip-10-1-2-3"),
+				attribute.Bool("exported.image.retried", false),
+			},
+		},
+		{
+			name: "keeps a partially matching value",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{mustParseRelabelRule(t, "exported.host", "10-1", "batch", "")}
+			},
+			want: attributes(),
+		},
+		{
+			name: "adds the target with capture groups",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{mustParseRelabelRule(t, "exported.host", `ip-(?P<subnet>\d+-\d+)-.*`, "subnet-${subnet}", "exported.node.pool")}
+			},
+			want: append(attributes(), attribute.String("exported.node.pool", "subnet-10-1")),
+		},
+		{
+			name: "matches non-string values",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{mustParseRelabelRule(t, "exported.image.retried", "false", "no", "")}
+			},
+			want: []attribute.KeyValue{
+				attribute.String("exported.image.tag", "3f9c2a1"),
+				attribute.String("exported.host", "ip-10-1-2-3"),
+				attribute.String("exported.image.retried", "no"),
+			},
+		},
+		{
+			name: "ignores a missing source",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{mustParseRelabelRule(t, "exported.team", ".*", "none", "")}
+			},
+			want: attributes(),
+		},
+		{
+			name: "later rules see earlier rewrites",
+			rules: func(t *testing.T) []RelabelRule {
+				return []RelabelRule{
+					mustParseRelabelRule(t, "exported.image.tag", "[0-9a-f]{7,40}", "sha", ""),
+					mustParseRelabelRule(t, "exported.image.tag", "sha", "commit", ""),
+				}
+			},
+			want: []attribute.KeyValue{
+				attribute.String("exported.image.tag", "commit"),
+				attribute.String("exported.host", "ip-10-1-2-3"),
+				attribute.Bool("exported.image.retried", false),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t, WithRelabelRules(tt.rules(t)...))
+			got, want := attribute.NewSet(h.relabel(attributes())...), attribute.NewSet(tt.want...)
+			if !got.Equals(&want) {
+				t.Errorf("relabel() = %v, want %v", got.ToSlice(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRelabelRuleRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		regex  string
+	}{
+		{name: "missing source", regex: ".*"},
+		{name: "invalid regex", source: "exported.host", regex: "ip-(10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRelabelRule(tt.source, tt.regex, "x", ""); err == nil {
+				t.Error("ParseRelabelRule() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestRelabelRecordedPulls(t *testing.T) {
+	h, reader := newTestHandler(t, WithRelabelRules(mustParseRelabelRule(t, "exported.image.tag", "1\\.(\\d+)", "v1", "")))
+	h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000)))
+
+	points := collect(t, reader, "k8s.image.pull.duration")
+	if len(points) != 1 {
+		t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(points))
+	}
+	if got := attributeValue(points[0].attributes, "exported.image.tag"); got != "v1" {
+		t.Errorf("exported.image.tag = %q, want v1", got)
+	}
+}
@@ -0,0 +1,22 @@
+package pullmetrics
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// isRepull records a pull of image on the event's node and reports whether
+// the node already pulled it within the repull window, which points at image
+// garbage collection pressure or eviction churn. A zero window disables the
+// detection.
+func (h *Handler) isRepull(event *v1.Event, image string) bool {
+	if h.opts().repullWindow <= 0 {
+		return false
+	}
+
+	repulled := false
+	h.nodePulls.update(eventHost(event)+"/"+image, func(_ struct{}, found bool) struct{} {
+		repulled = found
+		return struct{}{}
+	})
+	return repulled
+}
@@ -0,0 +1,44 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepull(t *testing.T) {
+	const window = 100 * time.Millisecond
+	type pull struct {
+		node  string
+		image string
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		second pull
+		sleep  bool
+		want   float64
+	}{
+		{name: "same node within the window", window: window, second: pull{"node-1", "nginx:1.27"}, want: 1},
+		{name: "same node after the window", window: window, second: pull{"node-1", "nginx:1.27"}, sleep: true},
+		{name: "other node", window: window, second: pull{"node-2", "nginx:1.27"}},
+		{name: "other image", window: window, second: pull{"node-1", "nginx:1.28"}},
+		{name: "disabled", second: pull{"node-1", "nginx:1.27"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithRepullWindow(tt.window))
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage("nginx:1.27", time.Second, 1000)))
+			if tt.sleep {
+				time.Sleep(2 * tt.window)
+			}
+			event := podEvent("", "web-2", "Pulled", pulledMessage(tt.second.image, time.Second, 1000))
+			event.Source.Host = tt.second.node
+			h.OnEvent(context.Background(), event)
+
+			if got := sum(collect(t, reader, "k8s.image.repull")); got != tt.want {
+				t.Errorf("k8s.image.repull = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package pullmetrics
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// sampled reports whether the pull of event is recorded under the sample
+// rate. The decision hashes the event's UID, so it's the same for every
+// delivery of the event and across restarts.
+func (h *Handler) sampled(event *v1.Event) bool {
+	if h.opts().sampleRate >= 1 {
+		return true
+	}
+	// UIDs differ in few characters, which simpler hashes don't spread
+	// evenly enough
+	sum := sha256.Sum256([]byte(event.UID))
+	return float64(binary.BigEndian.Uint64(sum[:8])) < h.opts().sampleRate*math.MaxUint64
+}
@@ -0,0 +1,119 @@
+package pullmetrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// sampledUIDs returns n event UIDs whose pulls h records if in is true, or
+// samples out otherwise.
+func sampledUIDs(t *testing.T, h *Handler, in bool, n int) []types.UID {
+	t.Helper()
+	var uids []types.UID
+	for i := 0; len(uids) < n; i++ {
+		if i > 1000 {
+			t.Fatal("not enough sampled UIDs found")
+		}
+		uid := types.UID(fmt.Sprintf("uid-%d", i))
+		if h.sampled(podEvent(uid, "", "", "")) == in {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+func TestSamplingKeepsCorrelationState(t *testing.T) {
+	const image = "registry.example.com/web:1.0"
+	type event struct {
+		sampled              bool
+		pod, reason, message string
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		events []event
+		check  func(t *testing.T, points readerFunc)
+	}{
+		{
+			name: "failures are taken by sampled out pulls",
+			events: []event{
+				{true, "web-1", "Failed", `Failed to pull image "` + image + `": 429 Too Many Requests`},
+				{false, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+				{true, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+			},
+			check: func(t *testing.T, points readerFunc) {
+				durations := points("k8s.image.pull.duration")
+				if len(durations) != 1 {
+					t.Fatalf("k8s.image.pull.duration has %d data points, want 1", len(durations))
+				}
+				if got := attributeValue(durations[0].attributes, "exported.image.retried"); got != "false" {
+					t.Errorf("exported.image.retried = %q, want false", got)
+				}
+			},
+		},
+		{
+			name: "re-pull after a sampled out pull",
+			opts: []Option{WithRepullWindow(time.Hour)},
+			events: []event{
+				{false, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+				{true, "web-2", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+			},
+			check: func(t *testing.T, points readerFunc) {
+				if got := sum(points("k8s.image.repull")); got != 1 {
+					t.Errorf("k8s.image.repull = %v, want 1", got)
+				}
+			},
+		},
+		{
+			name: "flapping after a sampled out pull",
+			opts: []Option{WithFlapThreshold(1, time.Hour)},
+			events: []event{
+				{false, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+				{true, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+			},
+			check: func(t *testing.T, points readerFunc) {
+				if got := sum(points("k8s.image.pull.flapping")); got != 1 {
+					t.Errorf("k8s.image.pull.flapping = %v, want 1", got)
+				}
+				if got := len(points("k8s.image.pull.duration")); got != 0 {
+					t.Errorf("k8s.image.pull.duration has %d data points, want none", got)
+				}
+			},
+		},
+		{
+			name: "size growth between sampled out pulls",
+			opts: []Option{WithSizeGrowthThreshold(10)},
+			events: []event{
+				{false, "web-1", "Pulled", pulledMessage(image, 2*time.Second, 1000)},
+				{false, "web-2", "Pulled", pulledMessage(image, 2*time.Second, 2000)},
+			},
+			check: func(t *testing.T, points readerFunc) {
+				if got := sum(points("k8s.image.size.growth")); got != 1000 {
+					t.Errorf("k8s.image.size.growth = %v, want 1000", got)
+				}
+				if got := sum(points("k8s.image.pulls")); got != 2 {
+					t.Errorf("k8s.image.pulls = %v, want 2", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, append(tt.opts, WithSampleRate(0.5))...)
+			in, out := sampledUIDs(t, h, true, len(tt.events)), sampledUIDs(t, h, false, len(tt.events))
+			for i, e := range tt.events {
+				uid := out[i]
+				if e.sampled {
+					uid = in[i]
+				}
+				h.OnEvent(context.Background(), podEvent(uid, e.pod, e.reason, e.message))
+			}
+			tt.check(t, func(name string) []dataPoint { return collect(t, reader, name) })
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package pullmetrics
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// imageSizesTTL is how long the last size of an image tag is remembered
+// without being pulled again.
+const imageSizesTTL = 7 * 24 * time.Hour
+
+// sizeGrowth records size as the latest size of the image tag referenced by
+// ref and returns by how many bytes it grew since the previous pull, if that
+// exceeds the size growth threshold. Digest-only references are skipped, as
+// their content can't change.
+func (h *Handler) sizeGrowth(ref imageRef, size int64) (int64, bool) {
+	if h.opts().sizeGrowthThreshold <= 0 || ref.tag == "" || size <= 0 {
+		return 0, false
+	}
+
+	var previous int64
+	h.imageSizes.update(ref.registry+"/"+ref.repository+":"+ref.tag, func(last int64, found bool) int64 {
+		if found {
+			previous = last
+		}
+		return size
+	})
+	if previous <= 0 || float64(size-previous) <= float64(previous)*h.opts().sizeGrowthThreshold/100 {
+		return 0, false
+	}
+	return size - previous, true
+}
+
+// sizeGrowthAttributes identify the image tag whose size grew.
+func (h *Handler) sizeGrowthAttributes(ref imageRef) []attribute.KeyValue {
+	return append(h.clusterAttributes(),
+		h.attrKey("image.registry").String(normalizeRegistry(ref.registry)),
+		h.attrKey("image.repository").String(ref.repository),
+		h.attrKey("image.tag").String(ref.tag),
+	)
+}
@@ -0,0 +1,54 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSizeGrowth(t *testing.T) {
+	type pull struct {
+		image string
+		size  int64
+	}
+	tests := []struct {
+		name      string
+		threshold float64
+		pulls     []pull
+		// growth recorded per image tag
+		want map[string]float64
+	}{
+		{name: "stable size", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 1000}}},
+		{name: "shrinking", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 500}}},
+		{name: "growth at the threshold", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 1100}}},
+		{name: "growth over the threshold", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 1500}}, want: map[string]float64{"1.27": 500}},
+		{name: "first pull", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}}},
+		{name: "other tag", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.28", 5000}}},
+		{name: "latest growth", threshold: 10, pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 2000}, {"nginx:1.27", 2000}}, want: map[string]float64{"1.27": 1000}},
+		{name: "disabled", pulls: []pull{{"nginx:1.27", 1000}, {"nginx:1.27", 5000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, WithSizeGrowthThreshold(tt.threshold))
+			for _, p := range tt.pulls {
+				h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage(p.image, time.Second, p.size)))
+			}
+
+			got := make(map[string]float64)
+			for _, p := range collect(t, reader, "k8s.image.size.growth") {
+				if repository := attributeValue(p.attributes, "exported.image.repository"); repository != "library/nginx" {
+					t.Errorf("exported.image.repository = %q, want library/nginx", repository)
+				}
+				got[attributeValue(p.attributes, "exported.image.tag")] = p.value
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("k8s.image.size.growth = %v, want %v", got, tt.want)
+			}
+			for tag, growth := range tt.want {
+				if got[tag] != growth {
+					t.Errorf("k8s.image.size.growth of %s = %v, want %v", tag, got[tag], growth)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package pullmetrics
+
+import (
+	"path"
+	"time"
+)
+
+// SLOThreshold is the pull duration above which a pull from a registry
+// matching Pattern violates its SLO.
+type SLOThreshold struct {
+	// Pattern is matched against the registry host with path.Match, e.g.
+	// "*.dkr.ecr.*.amazonaws.com" or "*" for any registry
+	Pattern   string
+	Threshold time.Duration
+}
+
+// sloThreshold returns the threshold of the first SLO whose pattern matches
+// registry, or false if none does.
+func (h *Handler) sloThreshold(registry string) (time.Duration, bool) {
+	registry = normalizeRegistry(registry)
+	for _, slo := range h.opts().sloThresholds {
+		if ok, _ := path.Match(slo.Pattern, registry); ok {
+			return slo.Threshold, true
+		}
+	}
+	return 0, false
+}
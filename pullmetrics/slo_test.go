@@ -0,0 +1,40 @@
+package pullmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSLOViolations(t *testing.T) {
+	thresholds := WithSLOThresholds(
+		SLOThreshold{Pattern: "*.dkr.ecr.*.amazonaws.com", Threshold: 30 * time.Second},
+		SLOThreshold{Pattern: "docker.io", Threshold: time.Minute},
+		SLOThreshold{Pattern: "*", Threshold: 5 * time.Minute},
+	)
+	tests := []struct {
+		name     string
+		opts     []Option
+		image    string
+		duration time.Duration
+		want     float64
+	}{
+		{name: "below the registry threshold", opts: []Option{thresholds}, image: "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web:1.4", duration: 20 * time.Second},
+		{name: "above the registry threshold", opts: []Option{thresholds}, image: "123456789012.dkr.ecr.eu-west-1.amazonaws.com/web:1.4", duration: 40 * time.Second, want: 1},
+		{name: "at the threshold", opts: []Option{thresholds}, image: "nginx:1.27", duration: time.Minute},
+		{name: "docker hub above its threshold", opts: []Option{thresholds}, image: "nginx:1.27", duration: 90 * time.Second, want: 1},
+		{name: "fallback below", opts: []Option{thresholds}, image: "ghcr.io/acme/web:1.4", duration: 90 * time.Second},
+		{name: "fallback above", opts: []Option{thresholds}, image: "ghcr.io/acme/web:1.4", duration: 6 * time.Minute, want: 1},
+		{name: "no thresholds", image: "nginx:1.27", duration: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, reader := newTestHandler(t, tt.opts...)
+			h.OnEvent(context.Background(), podEvent("", "web-1", "Pulled", pulledMessage(tt.image, tt.duration, 1000)))
+
+			if got := sum(collect(t, reader, "k8s.image.pull.slo_violations")); got != tt.want {
+				t.Errorf("k8s.image.pull.slo_violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package pullmetrics
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type ttlEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// ttlMap is a concurrency-safe map whose entries expire ttl after they were
+// last written. Once it holds maxEntries, the least recently used entry is
+// evicted to make room for a new one. maxEntries must be positive.
+type ttlMap[K comparable, V any] struct {
+	mu         sync.Mutex
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	entries    map[K]*list.Element
+	// lru orders the entries from most to least recently used
+	lru *list.List
+
+	// onExpire, if set, is called with m.mu held for every entry that is
+	// dropped because it expired or was evicted, but not for deleted ones.
+	onExpire func(K, V)
+}
+
+func newTTLMap[K comparable, V any](name string, ttl time.Duration, maxEntries int) *ttlMap[K, V] {
+	return &ttlMap[K, V]{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[K]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the value stored for key if it hasn't expired.
+func (m *ttlMap[K, V]) get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok || m.expireIfStale(el, time.Now()) {
+		var zero V
+		return zero, false
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*ttlEntry[K, V]).value, true
+}
+
+// update stores fn(current, found) for key and refreshes its expiry.
+func (m *ttlMap[K, V]) update(key K, fn func(V, bool) V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	el, ok := m.entries[key]
+	if ok && m.expireIfStale(el, now) {
+		ok = false
+	}
+	if ok {
+		e := el.Value.(*ttlEntry[K, V])
+		e.value, e.expires = fn(e.value, true), now.Add(m.ttl)
+		m.lru.MoveToFront(el)
+		return
+	}
+
+	for m.lru.Len() >= m.maxEntries {
+		m.drop(m.lru.Back())
+	}
+	var zero V
+	e := &ttlEntry[K, V]{key: key, value: fn(zero, false), expires: now.Add(m.ttl)}
+	m.entries[key] = m.lru.PushFront(e)
+}
+
+// delete removes key and returns its value if it hadn't expired.
+func (m *ttlMap[K, V]) delete(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok || m.expireIfStale(el, time.Now()) {
+		var zero V
+		return zero, false
+	}
+	delete(m.entries, key)
+	m.lru.Remove(el)
+	return el.Value.(*ttlEntry[K, V]).value, true
+}
+
+// sweep drops all expired entries. Maps with an onExpire callback should be
+// swept periodically so the callback fires even for keys never seen again.
+func (m *ttlMap[K, V]) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for el := m.lru.Front(); el != nil; {
+		next := el.Next()
+		m.expireIfStale(el, now)
+		el = next
+	}
+}
+
+func (m *ttlMap[K, V]) size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *ttlMap[K, V]) cacheName() string {
+	return m.name
+}
+
+// expireIfStale must be called with m.mu held.
+func (m *ttlMap[K, V]) expireIfStale(el *list.Element, now time.Time) bool {
+	if !now.After(el.Value.(*ttlEntry[K, V]).expires) {
+		return false
+	}
+	m.drop(el)
+	return true
+}
+
+// drop must be called with m.mu held.
+func (m *ttlMap[K, V]) drop(el *list.Element) {
+	e := el.Value.(*ttlEntry[K, V])
+	delete(m.entries, e.key)
+	m.lru.Remove(el)
+	if m.onExpire != nil {
+		m.onExpire(e.key, e.value)
+	}
+}
+
+// sizedCache is a map whose size is reported by k8s.image.pull.cache_size.
+type sizedCache interface {
+	cacheName() string
+	size() int
+}
+
+// registerCacheSizeGauge reports the number of entries held by each cache,
+// along with attributes. The callback is registered separately from the
+// instrument so that several Handlers sharing a meter each report theirs.
+func registerCacheSizeGauge(meter metric.Meter, attributes metric.ObserveOption, caches ...sizedCache) error {
+	gauge, err := meter.Int64ObservableGauge(
+		"k8s.image.pull.cache_size",
+		metric.WithDescription("The number of entries held by the in-memory correlation caches."),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, c := range caches {
+			o.ObserveInt64(gauge, int64(c.size()), metric.WithAttributes(attribute.String("cache", c.cacheName())), attributes)
+		}
+		return nil
+	}, gauge)
+	return err
+}
@@ -0,0 +1,163 @@
+package pullmetrics
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestTTLMapEvictsLeastRecentlyUsed(t *testing.T) {
+	tests := []struct {
+		name string
+		// ops are applied in order: "+k" updates k, "?k" gets k
+		ops  []string
+		want []string
+	}{
+		{
+			name: "oldest write evicted",
+			ops:  []string{"+a", "+b", "+c", "+d"},
+			want: []string{"b", "c", "d"},
+		},
+		{
+			name: "get refreshes recency",
+			ops:  []string{"+a", "+b", "+c", "?a", "+d"},
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name: "update refreshes recency",
+			ops:  []string{"+a", "+b", "+c", "+a", "+d", "+e"},
+			want: []string{"a", "d", "e"},
+		},
+		{
+			name: "updating a present key evicts nothing",
+			ops:  []string{"+a", "+b", "+c", "+b", "+c"},
+			want: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTTLMap[string, int]("test", time.Hour, 3)
+			var expired []string
+			m.onExpire = func(key string, _ int) { expired = append(expired, key) }
+			for _, op := range tt.ops {
+				key := op[1:]
+				if op[0] == '+' {
+					m.update(key, func(v int, _ bool) int { return v + 1 })
+				} else {
+					m.get(key)
+				}
+			}
+
+			var got []string
+			for _, key := range []string{"a", "b", "c", "d", "e"} {
+				if _, ok := m.get(key); ok {
+					got = append(got, key)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+			if m.size() != len(tt.want) {
+				t.Errorf("size = %d, want %d", m.size(), len(tt.want))
+			}
+			// every key that was written but is gone was evicted
+			var evicted []string
+			for _, op := range tt.ops {
+				if key := op[1:]; op[0] == '+' && !slices.Contains(tt.want, key) && !slices.Contains(evicted, key) {
+					evicted = append(evicted, key)
+				}
+			}
+			if !slices.Equal(expired, evicted) {
+				t.Errorf("onExpire called for %v, want %v", expired, evicted)
+			}
+		})
+	}
+}
+
+func TestTTLMapExpiry(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	t.Run("get", func(t *testing.T) {
+		m := newTTLMap[string, int]("test", ttl, 10)
+		m.update("a", func(int, bool) int { return 1 })
+		if v, ok := m.get("a"); !ok || v != 1 {
+			t.Fatalf("get before expiry = %d, %v, want 1, true", v, ok)
+		}
+		time.Sleep(2 * ttl)
+		if _, ok := m.get("a"); ok {
+			t.Error("get after expiry found the entry")
+		}
+	})
+
+	t.Run("update starts over", func(t *testing.T) {
+		m := newTTLMap[string, int]("test", ttl, 10)
+		m.update("a", func(int, bool) int { return 1 })
+		time.Sleep(2 * ttl)
+		var found bool
+		m.update("a", func(v int, ok bool) int { found = ok; return v + 1 })
+		if found {
+			t.Error("update after expiry found the entry")
+		}
+		if v, _ := m.get("a"); v != 1 {
+			t.Errorf("value = %d, want 1", v)
+		}
+	})
+
+	t.Run("update refreshes expiry", func(t *testing.T) {
+		m := newTTLMap[string, int]("test", 4*ttl, 10)
+		m.update("a", func(int, bool) int { return 1 })
+		for range 3 {
+			time.Sleep(2 * ttl)
+			m.update("a", func(v int, _ bool) int { return v + 1 })
+		}
+		if v, ok := m.get("a"); !ok || v != 4 {
+			t.Errorf("get = %d, %v, want 4, true", v, ok)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		m := newTTLMap[string, int]("test", ttl, 10)
+		m.update("a", func(int, bool) int { return 1 })
+		m.update("b", func(int, bool) int { return 2 })
+		if v, ok := m.delete("a"); !ok || v != 1 {
+			t.Errorf("delete = %d, %v, want 1, true", v, ok)
+		}
+		time.Sleep(2 * ttl)
+		if _, ok := m.delete("b"); ok {
+			t.Error("delete after expiry returned the entry")
+		}
+	})
+}
+
+func TestTTLMapOnExpire(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	m := newTTLMap[string, int]("test", ttl, 10)
+	expired := map[string]int{}
+	m.onExpire = func(key string, v int) { expired[key] = v }
+
+	m.update("a", func(int, bool) int { return 1 })
+	m.update("b", func(int, bool) int { return 2 })
+	m.update("c", func(int, bool) int { return 3 })
+	m.delete("c")
+	time.Sleep(2 * ttl)
+	m.update("d", func(int, bool) int { return 4 })
+	m.sweep()
+
+	want := map[string]int{"a": 1, "b": 2}
+	if len(expired) != len(want) || expired["a"] != 1 || expired["b"] != 2 {
+		t.Errorf("onExpire called with %v, want %v (not for deleted or fresh entries)", expired, want)
+	}
+	if m.size() != 1 {
+		t.Errorf("size after sweep = %d, want 1", m.size())
+	}
+}
+
+func TestNewRejectsNonPositiveCacheMaxEntries(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if _, err := New(noop.NewMeterProvider().Meter("test"), WithCacheMaxEntries(n)); err == nil {
+			t.Errorf("New with WithCacheMaxEntries(%d) succeeded, want an error", n)
+		}
+	}
+}
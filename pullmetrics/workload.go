@@ -0,0 +1,66 @@
+package pullmetrics
+
+import (
+	"regexp"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// extracts the prefix of a pod name created by a Deployment's ReplicaSet
+// given: k8s-image-pull-metrics-5f588dd8cf-8lnm4
+// extract: k8s-image-pull-metrics
+var podPrefixRe = regexp.MustCompile(`^(.*)-.*-.*$`)
+
+// podPrefix returns the name of the workload a pod belongs to, used to group
+// pulls across the pod's replicas. Pods of Jobs are attributed to the Job, or
+// to the CronJob that spawned it, since their names embed a schedule
+// timestamp that the name-based heuristic would treat as part of the prefix.
+// It returns "" when no prefix can be derived.
+func (h *Handler) podPrefix(namespace, podName string) string {
+	if pod, ok := h.lookups.getPod(namespace, podName); ok {
+		if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "Job" {
+			if job, ok := h.lookups.getJob(namespace, owner.Name); ok {
+				if cronJob := metav1.GetControllerOf(job); cronJob != nil && cronJob.Kind == "CronJob" {
+					return cronJob.Name
+				}
+			}
+			return owner.Name
+		}
+	}
+
+	matches := podPrefixRe.FindStringSubmatch(podName)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// rolloutWindow is how long after its ReplicaSet was created a pod still
+// counts as part of the rollout that created the ReplicaSet.
+const rolloutWindow = 15 * time.Minute
+
+// pullCause classifies, on a best-effort basis, why the pod of a pull was
+// created: "rollout" if its ReplicaSet was created at most rolloutWindow
+// before it, i.e. the pod belongs to a new revision of a Deployment, and
+// "scaleup" if the ReplicaSet is older, i.e. replicas were added to an
+// existing revision. It returns "unknown" for pods not owned by a
+// ReplicaSet or when the objects can't be looked up.
+func (h *Handler) pullCause(namespace, podName string) string {
+	pod, ok := h.lookups.getPod(namespace, podName)
+	if !ok {
+		return "unknown"
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return "unknown"
+	}
+	rs, ok := h.lookups.getReplicaSet(namespace, owner.Name)
+	if !ok {
+		return "unknown"
+	}
+	if pod.CreationTimestamp.Sub(rs.CreationTimestamp.Time) <= rolloutWindow {
+		return "rollout"
+	}
+	return "scaleup"
+}
@@ -0,0 +1,93 @@
+package pullmetrics
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// withFakeLookups looks objects up from a fake clientset holding objects.
+// The informers aren't started, so every lookup falls back to the client.
+func withFakeLookups(objects ...runtime.Object) Option {
+	client := fake.NewClientset(objects...)
+	return WithLookups(client, informers.NewSharedInformerFactory(client, 0), 1000, 1000)
+}
+
+// owned returns metadata of an object named name in the default namespace,
+// created at created and controlled by the kind named owner, if set.
+func owned(name string, created time.Time, kind, owner string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, CreationTimestamp: metav1.NewTime(created)}
+	if owner != "" {
+		controller := true
+		meta.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+	}
+	return meta
+}
+
+func TestPodPrefix(t *testing.T) {
+	now := time.Now()
+	objects := []runtime.Object{
+		&v1.Pod{ObjectMeta: owned("backup-28930140-x7k2p", now, "Job", "backup-28930140")},
+		&batchv1.Job{ObjectMeta: owned("backup-28930140", now, "CronJob", "backup")},
+		&v1.Pod{ObjectMeta: owned("migrate-v2-abcde", now, "Job", "migrate-v2")},
+		&batchv1.Job{ObjectMeta: owned("migrate-v2", now, "", "")},
+		&v1.Pod{ObjectMeta: owned("orphan-1-abcde", now, "Job", "orphan-1")},
+		&v1.Pod{ObjectMeta: owned("web-5d8f7c9b4-x2x7k", now, "ReplicaSet", "web-5d8f7c9b4")},
+	}
+
+	tests := []struct {
+		pod  string
+		want string
+	}{
+		{"backup-28930140-x7k2p", "backup"},
+		{"migrate-v2-abcde", "migrate-v2"},
+		// the Job can't be found, so the pod is attributed to it by name
+		{"orphan-1-abcde", "orphan-1"},
+		{"web-5d8f7c9b4-x2x7k", "web"},
+		// unknown pods fall back to the name
+		{"api-7c9d8b6f5-q4w2e", "api"},
+		{"standalone", ""},
+	}
+	h, _ := newTestHandler(t, withFakeLookups(objects...))
+	for _, tt := range tests {
+		if got := h.podPrefix(metav1.NamespaceDefault, tt.pod); got != tt.want {
+			t.Errorf("podPrefix(%q) = %q, want %q", tt.pod, got, tt.want)
+		}
+	}
+}
+
+func TestPullCause(t *testing.T) {
+	now := time.Now()
+	objects := []runtime.Object{
+		&appsv1.ReplicaSet{ObjectMeta: owned("web-new", now.Add(-5*time.Minute), "", "")},
+		&appsv1.ReplicaSet{ObjectMeta: owned("web-old", now.Add(-24*time.Hour), "", "")},
+		&v1.Pod{ObjectMeta: owned("web-new-abcde", now, "ReplicaSet", "web-new")},
+		&v1.Pod{ObjectMeta: owned("web-old-abcde", now, "ReplicaSet", "web-old")},
+		&v1.Pod{ObjectMeta: owned("web-gone-abcde", now, "ReplicaSet", "web-gone")},
+		&v1.Pod{ObjectMeta: owned("backup-1-abcde", now, "Job", "backup-1")},
+	}
+
+	tests := []struct {
+		pod  string
+		want string
+	}{
+		{"web-new-abcde", "rollout"},
+		{"web-old-abcde", "scaleup"},
+		{"web-gone-abcde", "unknown"},
+		{"backup-1-abcde", "unknown"},
+		{"missing", "unknown"},
+	}
+	h, _ := newTestHandler(t, withFakeLookups(objects...))
+	for _, tt := range tests {
+		if got := h.pullCause(metav1.NamespaceDefault, tt.pod); got != tt.want {
+			t.Errorf("pullCause(%q) = %q, want %q", tt.pod, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"k8s-image-pull-metrics/pullmetrics"
+
+	"sigs.k8s.io/yaml"
+)
+
+// relabelFile is the format of -relabel-config, e.g.
+//
+//	rules:
+//	- source: exported.image.tag
+//	  regex: '[0-9a-f]{7,40}'
+//	  replacement: sha
+//	- source: exported.host
+//	  regex: 'ip-10-1-.*'
+//	  replacement: batch
+//	  target: exported.node.pool
+type relabelFile struct {
+	Rules []relabelRule `json:"rules"`
+}
+
+type relabelRule struct {
+	Source      string `json:"source"`
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+	Target      string `json:"target,omitempty"`
+}
+
+// loadRelabelRules reads the rules of a YAML or JSON -relabel-config,
+// rejecting unknown fields and invalid regular expressions.
+func loadRelabelRules(path string) ([]pullmetrics.RelabelRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file relabelFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	rules := make([]pullmetrics.RelabelRule, len(file.Rules))
+	for i, r := range file.Rules {
+		rules[i], err = pullmetrics.ParseRelabelRule(r.Source, r.Regex, r.Replacement, r.Target)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return rules, nil
+}
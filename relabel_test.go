@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRelabelRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "yaml",
+			content: `rules:
+- source: exported.image.tag
+  regex: '[0-9a-f]{7,40}'
+  replacement: sha
+- source: exported.host
+  regex: 'ip-10-1-.*'
+  replacement: batch
+  target: exported.node.pool
+`,
+			want: []string{"exported.image.tag -> exported.image.tag", "exported.host -> exported.node.pool"},
+		},
+		{
+			name:    "json",
+			content: `{"rules": [{"source": "exported.image.tag", "regex": "latest", "replacement": "floating"}]}`,
+			want:    []string{"exported.image.tag -> exported.image.tag"},
+		},
+		{name: "empty", content: "rules: []\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := loadRelabelRules(writeViewsFile(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range rules {
+				got = append(got, r.Source+" -> "+r.Target)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadRelabelRules() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("rule %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRelabelRulesRejectsInvalidFiles(t *testing.T) {
+	for _, content := range []string{
+		"rules:\n- regex: '.*'\n  replacement: x\n",
+		"rules:\n- source: exported.host\n  regex: 'ip-(10'\n",
+		"rules:\n- source: exported.host\n  action: drop\n",
+		"rules: {source: exported.host}\n",
+	} {
+		if _, err := loadRelabelRules(writeViewsFile(t, content)); err == nil {
+			t.Errorf("loadRelabelRules(%q) succeeded, want an error", content)
+		}
+	}
+	if _, err := loadRelabelRules(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadRelabelRules of a missing file succeeded, want an error")
+	}
+}
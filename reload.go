@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// reloadableFlags are the flags re-read from -config on SIGHUP. They map to
+// the Handler options that can change at runtime, see
+// pullmetrics.Handler.Reload. Changing any other key requires a restart.
+// They must be flags of the standard types, see scratchFlags.
+var reloadableFlags = []string{
+	"max-event-age",
+	"min-pull-duration",
+	"node-pool-label",
+	"registry-allowlist",
+	"registry-denylist",
+	"relabel-config",
+	"sample-rate",
+	"size-growth-threshold",
+	"slo-thresholds",
+	"snapshotter-label",
+}
+
+// reloadConfigFile sets the reloadable flags of fs from the config file at
+// path again, resetting those the file no longer sets to their defaults.
+// Flags in onCommandLine keep their values, and all other keys of the file
+// are ignored.
+func reloadConfigFile(fs *flag.FlagSet, path string, onCommandLine map[string]bool) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	args := map[string]string{}
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown key %q", name)
+		}
+		if !slices.Contains(reloadableFlags, name) {
+			continue
+		}
+		values, err := configValues(value, false)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", name, err)
+		}
+		args[name] = values[0]
+	}
+
+	// set the values on copies of the flags first, so an invalid file
+	// changes nothing
+	if err := setReloadableFlags(scratchFlags(fs), args, onCommandLine); err != nil {
+		return err
+	}
+	return setReloadableFlags(fs, args, onCommandLine)
+}
+
+// setReloadableFlags sets the reloadable flags of fs to args, or to their
+// defaults if args doesn't have them, except those in onCommandLine.
+func setReloadableFlags(fs *flag.FlagSet, args map[string]string, onCommandLine map[string]bool) error {
+	for _, name := range reloadableFlags {
+		if onCommandLine[name] {
+			continue
+		}
+		arg, ok := args[name]
+		if !ok {
+			arg = fs.Lookup(name).DefValue
+		}
+		if err := fs.Set(name, arg); err != nil {
+			return fmt.Errorf("key %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// scratchFlags returns a FlagSet with the reloadable flags of fs, each
+// backed by a new value of the same type, so setting them leaves fs alone.
+// The flag package's values are pointers to basic types, so a new one is
+// just a new pointer to their element type.
+func scratchFlags(fs *flag.FlagSet) *flag.FlagSet {
+	scratch := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	for _, name := range reloadableFlags {
+		f := fs.Lookup(name)
+		value := reflect.New(reflect.TypeOf(f.Value).Elem()).Interface().(flag.Value)
+		scratch.Var(value, name, f.Usage)
+		scratch.Lookup(name).DefValue = f.DefValue
+	}
+	return scratch
+}
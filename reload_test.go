@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newReloadFlagSet returns a FlagSet with the reloadable flags and their
+// defaults as defined by run, plus a flag that can't be reloaded.
+func newReloadFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("max-event-age", 0, "")
+	fs.Duration("min-pull-duration", 0, "")
+	fs.String("node-pool-label", "", "")
+	fs.String("registry-allowlist", "", "")
+	fs.String("registry-denylist", "", "")
+	fs.String("relabel-config", "", "")
+	fs.Float64("sample-rate", 1, "")
+	fs.Float64("size-growth-threshold", 0, "")
+	fs.String("slo-thresholds", "", "")
+	fs.String("snapshotter-label", "", "")
+	fs.String("exporter", "otlp", "")
+	fs.String("config", "", "")
+	return fs
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// args are given on the command line, initial is the config file
+		// applied on startup and reloaded the one read on SIGHUP
+		args     []string
+		initial  string
+		reloaded string
+		wantErr  bool
+		want     map[string]string
+	}{
+		{
+			name:     "changed values",
+			initial:  "sample-rate: 0.5\nmax-event-age: 10m\n",
+			reloaded: "sample-rate: 0.25\nmax-event-age: 5m\nregistry-denylist: [registry.k8s.io, public.ecr.aws]\n",
+			want:     map[string]string{"sample-rate": "0.25", "max-event-age": "5m0s", "registry-denylist": "registry.k8s.io,public.ecr.aws"},
+		},
+		{
+			name:     "removed keys fall back to defaults",
+			initial:  "sample-rate: 0.5\nnode-pool-label: pool\n",
+			reloaded: "node-pool-label: pool\n",
+			want:     map[string]string{"sample-rate": "1", "node-pool-label": "pool"},
+		},
+		{
+			name:     "command line takes precedence",
+			args:     []string{"-sample-rate=0.1"},
+			initial:  "min-pull-duration: 1s\n",
+			reloaded: "sample-rate: 0.5\nmin-pull-duration: 2s\n",
+			want:     map[string]string{"sample-rate": "0.1", "min-pull-duration": "2s"},
+		},
+		{
+			name:     "other keys are ignored",
+			initial:  "exporter: otlp\n",
+			reloaded: "exporter: prometheus\nsample-rate: 0.5\n",
+			want:     map[string]string{"exporter": "otlp", "sample-rate": "0.5"},
+		},
+		{
+			name:     "invalid value changes nothing",
+			initial:  "sample-rate: 0.5\nmax-event-age: 10m\n",
+			reloaded: "sample-rate: 0.25\nmax-event-age: 600\nmin-pull-duration: 2s\n",
+			wantErr:  true,
+			want:     map[string]string{"sample-rate": "0.5", "max-event-age": "10m0s", "min-pull-duration": "0s"},
+		},
+		{
+			name:     "invalid later value changes nothing",
+			initial:  "max-event-age: 10m\n",
+			reloaded: "max-event-age: 5m\nnode-pool-label: pool\nsize-growth-threshold: lots\n",
+			wantErr:  true,
+			want:     map[string]string{"max-event-age": "10m0s", "node-pool-label": "", "size-growth-threshold": "0"},
+		},
+		{
+			name:     "unknown key",
+			initial:  "sample-rate: 0.5\n",
+			reloaded: "sample-rate: 0.25\nsampel-rate: 0.1\n",
+			wantErr:  true,
+			want:     map[string]string{"sample-rate": "0.5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			write := func(content string) {
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs := newReloadFlagSet()
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			onCommandLine := setFlags(fs)
+			write(tt.initial)
+			if err := applyConfigFile(fs, path); err != nil {
+				t.Fatal(err)
+			}
+
+			write(tt.reloaded)
+			err := reloadConfigFile(fs, path, onCommandLine)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reloadConfigFile() error = %v, want error %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("-%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScratchFlagsLeaveFlagSetAlone(t *testing.T) {
+	fs := newReloadFlagSet()
+	if err := fs.Set("max-event-age", "10m"); err != nil {
+		t.Fatal(err)
+	}
+	scratch := scratchFlags(fs)
+	if err := scratch.Set("max-event-age", "1h"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Lookup("max-event-age").Value.String(); got != (10 * time.Minute).String() {
+		t.Errorf("-max-event-age = %q after setting the scratch flag, want 10m0s", got)
+	}
+	if got := scratch.Lookup("sample-rate").DefValue; got != "1" {
+		t.Errorf("scratch -sample-rate default = %q, want 1", got)
+	}
+}
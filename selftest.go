@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// runSelfTest verifies the deployment can do its job without starting the
+// informers: it lists events to confirm API access and RBAC, then records a
+// synthetic metric and flushes it to confirm the metrics backend is reachable.
+func runSelfTest(ctx context.Context, clientset kubernetes.Interface, meter metric.Meter, flush func(context.Context) error) error {
+	if _, err := clientset.CoreV1().Events("").List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return fmt.Errorf("listing events: %w", err)
+	}
+
+	counter, err := meter.Int64Counter(
+		"k8s.image.pull.selftest",
+		metric.WithDescription("Synthetic metric recorded by -selftest."),
+	)
+	if err != nil {
+		return err
+	}
+	counter.Add(ctx, 1)
+
+	if err := flush(ctx); err != nil {
+		return fmt.Errorf("exporting metrics: %w", err)
+	}
+	return nil
+}
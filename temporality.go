@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// temporalitySelector returns the OTLP temporality selector for -temporality.
+//
+// With "delta" all counters and histograms report the change since the last
+// export. UpDownCounters such as k8s.image.pull.in_flight stay cumulative, as
+// their deltas are meaningless without the running total, and gauges have no
+// temporality.
+func temporalitySelector(temporality string) (sdkmetric.TemporalitySelector, error) {
+	switch temporality {
+	case "cumulative":
+		return sdkmetric.DefaultTemporalitySelector, nil
+	case "delta":
+		return deltaTemporality, nil
+	default:
+		return nil, fmt.Errorf("unknown temporality %q, expected cumulative or delta", temporality)
+	}
+}
+
+func deltaTemporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindCounter,
+		sdkmetric.InstrumentKindObservableCounter,
+		sdkmetric.InstrumentKindHistogram:
+		return metricdata.DeltaTemporality
+	default:
+		return metricdata.CumulativeTemporality
+	}
+}
+
+// instrumentKinds are the instrument kinds -temporality-by-kind accepts.
+// Gauges are missing as they have no temporality.
+var instrumentKinds = map[string]sdkmetric.InstrumentKind{
+	"counter":                  sdkmetric.InstrumentKindCounter,
+	"updowncounter":            sdkmetric.InstrumentKindUpDownCounter,
+	"histogram":                sdkmetric.InstrumentKindHistogram,
+	"observable_counter":       sdkmetric.InstrumentKindObservableCounter,
+	"observable_updowncounter": sdkmetric.InstrumentKindObservableUpDownCounter,
+}
+
+// overrideTemporality returns a selector using the temporalities listed in
+// overrides, a comma-separated list of kind=temporality pairs such as
+// "histogram=delta", and selector for all other kinds. The SDK selects
+// temporality by instrument kind only, so it can't differ between
+// instruments of the same kind.
+func overrideTemporality(selector sdkmetric.TemporalitySelector, overrides string) (sdkmetric.TemporalitySelector, error) {
+	byKind := make(map[sdkmetric.InstrumentKind]metricdata.Temporality)
+	for _, pair := range splitList(overrides) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid temporality override %q, expected kind=temporality", pair)
+		}
+		kind, ok := instrumentKinds[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown instrument kind %q, expected counter, updowncounter, histogram, observable_counter or observable_updowncounter", name)
+		}
+		switch strings.TrimSpace(value) {
+		case "cumulative":
+			byKind[kind] = metricdata.CumulativeTemporality
+		case "delta":
+			byKind[kind] = metricdata.DeltaTemporality
+		default:
+			return nil, fmt.Errorf("unknown temporality %q, expected cumulative or delta", value)
+		}
+	}
+	if len(byKind) == 0 {
+		return selector, nil
+	}
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		if t, ok := byKind[kind]; ok {
+			return t
+		}
+		return selector(kind)
+	}, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestTemporalitySelector(t *testing.T) {
+	tests := []struct {
+		kind           sdkmetric.InstrumentKind
+		wantCumulative metricdata.Temporality
+		wantDelta      metricdata.Temporality
+	}{
+		{sdkmetric.InstrumentKindCounter, metricdata.CumulativeTemporality, metricdata.DeltaTemporality},
+		{sdkmetric.InstrumentKindObservableCounter, metricdata.CumulativeTemporality, metricdata.DeltaTemporality},
+		{sdkmetric.InstrumentKindHistogram, metricdata.CumulativeTemporality, metricdata.DeltaTemporality},
+		{sdkmetric.InstrumentKindUpDownCounter, metricdata.CumulativeTemporality, metricdata.CumulativeTemporality},
+		{sdkmetric.InstrumentKindObservableUpDownCounter, metricdata.CumulativeTemporality, metricdata.CumulativeTemporality},
+		{sdkmetric.InstrumentKindGauge, metricdata.CumulativeTemporality, metricdata.CumulativeTemporality},
+	}
+	cumulative, err := temporalitySelector("cumulative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := temporalitySelector("delta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			if got := cumulative(tt.kind); got != tt.wantCumulative {
+				t.Errorf("cumulative(%s) = %s, want %s", tt.kind, got, tt.wantCumulative)
+			}
+			if got := delta(tt.kind); got != tt.wantDelta {
+				t.Errorf("delta(%s) = %s, want %s", tt.kind, got, tt.wantDelta)
+			}
+		})
+	}
+}
+
+func TestTemporalitySelectorRejectsUnknown(t *testing.T) {
+	if _, err := temporalitySelector("lowmemory"); err == nil {
+		t.Error("temporalitySelector(lowmemory) succeeded, want error")
+	}
+}
+
+func TestOverrideTemporality(t *testing.T) {
+	const (
+		cumulative = metricdata.CumulativeTemporality
+		delta      = metricdata.DeltaTemporality
+	)
+	kinds := []sdkmetric.InstrumentKind{
+		sdkmetric.InstrumentKindCounter,
+		sdkmetric.InstrumentKindUpDownCounter,
+		sdkmetric.InstrumentKindHistogram,
+		sdkmetric.InstrumentKindObservableCounter,
+		sdkmetric.InstrumentKindObservableUpDownCounter,
+	}
+	tests := []struct {
+		name      string
+		selector  sdkmetric.TemporalitySelector
+		overrides string
+		// temporality of each of kinds
+		want []metricdata.Temporality
+	}{
+		{name: "none", selector: sdkmetric.DefaultTemporalitySelector, want: []metricdata.Temporality{cumulative, cumulative, cumulative, cumulative, cumulative}},
+		{name: "histograms delta", selector: sdkmetric.DefaultTemporalitySelector, overrides: "histogram=delta", want: []metricdata.Temporality{cumulative, cumulative, delta, cumulative, cumulative}},
+		{name: "counters cumulative over delta", selector: deltaTemporality, overrides: "counter=cumulative, observable_counter=cumulative", want: []metricdata.Temporality{cumulative, cumulative, delta, cumulative, cumulative}},
+		{name: "updowncounter delta", selector: deltaTemporality, overrides: " updowncounter = delta ", want: []metricdata.Temporality{delta, delta, delta, delta, cumulative}},
+		{name: "last override wins", selector: sdkmetric.DefaultTemporalitySelector, overrides: "counter=delta,counter=cumulative", want: []metricdata.Temporality{cumulative, cumulative, cumulative, cumulative, cumulative}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := overrideTemporality(tt.selector, tt.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, kind := range kinds {
+				if got := selector(kind); got != tt.want[i] {
+					t.Errorf("selector(%s) = %s, want %s", kind, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOverrideTemporalityRejectsInvalidOverrides(t *testing.T) {
+	for _, overrides := range []string{
+		"histogram",
+		"gauge=delta",
+		"summary=delta",
+		"histogram=lowmemory",
+		"histogram=delta,counter",
+	} {
+		if _, err := overrideTemporality(sdkmetric.DefaultTemporalitySelector, overrides); err == nil {
+			t.Errorf("overrideTemporality(%q) succeeded, want error", overrides)
+		}
+	}
+}
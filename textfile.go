@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// writeTextfiles writes the metrics gathered from g to path in the
+// Prometheus text format every interval until ctx is done, for the node
+// exporter's textfile collector. Each write goes to a temporary file that is
+// renamed over path, so the collector never reads a partial file.
+func writeTextfiles(ctx context.Context, path string, g prometheus.Gatherer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			writeTextfile(path, g)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeTextfile(path string, g prometheus.Gatherer) {
+	if err := prometheus.WriteToTextfile(path, g); err != nil {
+		log.Println("Failed to write metrics textfile:", err)
+	}
+}
+
+// textfileReader is a Prometheus exporter whose metrics are written to a
+// textfile every interval until ctx is done, and once more when the meter
+// provider shuts it down, so the file ends up holding the final values.
+type textfileReader struct {
+	sdkmetric.Reader
+	path     string
+	registry *prometheus.Registry
+	stop     context.CancelFunc
+	done     chan struct{}
+}
+
+func newTextfileReader(ctx context.Context, path string, interval time.Duration) (*textfileReader, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(ctx)
+	r := &textfileReader{Reader: exporter, path: path, registry: registry, stop: stop, done: make(chan struct{})}
+	go func() {
+		defer close(r.done)
+		writeTextfiles(ctx, path, registry, interval)
+	}()
+	return r, nil
+}
+
+// Shutdown stops the periodic writes and writes the textfile a last time
+// before shutting the exporter down, after which it has nothing to gather.
+func (r *textfileReader) Shutdown(ctx context.Context) error {
+	r.stop()
+	<-r.done
+	writeTextfile(r.path, r.registry)
+	return r.Reader.Shutdown(ctx)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// waitForFile polls path until it contains want.
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, _ := os.ReadFile(path)
+		if strings.Contains(string(content), want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, want it to contain %q", path, content, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriteTextfiles(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pulls := prometheus.NewCounter(prometheus.CounterOpts{Name: "k8s_image_pulls_total"})
+	registry.MustRegister(pulls)
+	pulls.Add(3)
+	path := filepath.Join(t.TempDir(), "pulls.prom")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeTextfiles(ctx, path, registry, 10*time.Millisecond)
+	}()
+	waitForFile(t, path, "k8s_image_pulls_total 3")
+	pulls.Add(2)
+	waitForFile(t, path, "k8s_image_pulls_total 5")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writeTextfiles didn't return after ctx was done")
+	}
+}
+
+func TestTextfileReaderWritesOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulls.prom")
+	// the interval never elapses, so only the shutdown writes the file
+	reader, err := newTextfileReader(context.Background(), path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	counter, _ := provider.Meter("test").Int64Counter("k8s.image.pulls")
+	counter.Add(context.Background(), 4)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("textfile written before shutdown: %v", err)
+	}
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `k8s_image_pulls_total{otel_scope_name="test",otel_scope_version=""} 4`) {
+		t.Errorf("textfile = %q, want the final k8s_image_pulls_total of 4", content)
+	}
+}
+
+func TestTextfileReaderStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, err := newTextfileReader(ctx, filepath.Join(t.TempDir(), "pulls.prom"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-reader.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("periodic writes didn't stop after ctx was done")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"sigs.k8s.io/yaml"
+)
+
+// durationInstruments are the histograms recording pull durations.
+var durationInstruments = []string{
+	"k8s.image.pull.duration",
+	"k8s.image.pull_wait_only.duration",
+	"k8s.image.pull.since_pod_created",
+}
+
+// histogramAggregations returns the aggregations of the duration histograms
+// implementing -histogram-type and -histogram-min-max, keyed by instrument
+// name. With "explicit" the duration histograms keep the bucket boundaries
+// they were created with, buckets for all but the wait-only one, which uses
+// waitBuckets. With "exponential" they use base-2 exponential buckets, which
+// adjust their scale to the recorded range, so no boundaries need guessing.
+// Either records the minimum and maximum duration unless minMax is false.
+func histogramAggregations(histogramType string, minMax bool, buckets, waitBuckets []float64) (map[string]sdkmetric.Aggregation, error) {
+	aggregations := map[string]sdkmetric.Aggregation{}
+	switch histogramType {
+	case "explicit":
+		// the SDK records min and max by default, and the boundaries the
+		// instruments were created with only apply without an aggregation
+		if minMax {
+			return aggregations, nil
+		}
+		for _, name := range durationInstruments {
+			boundaries := buckets
+			if name == "k8s.image.pull_wait_only.duration" {
+				boundaries = waitBuckets
+			}
+			aggregations[name] = sdkmetric.AggregationExplicitBucketHistogram{Boundaries: boundaries, NoMinMax: true}
+		}
+		return aggregations, nil
+	case "exponential":
+		for _, name := range durationInstruments {
+			aggregations[name] = sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20, NoMinMax: !minMax}
+		}
+		return aggregations, nil
+	default:
+		return nil, fmt.Errorf("unknown histogram type %q, expected explicit or exponential", histogramType)
+	}
+}
+
+// newViews returns the views applying the rules of -views-file and the
+// histogram aggregations. The SDK exports an instrument once per matching
+// view, so the aggregation of an instrument matched by rules is merged into
+// each of them, unless the rule drops it, rather than added as a view of its
+// own that would export it again, unrenamed and undropped.
+func newViews(aggregations map[string]sdkmetric.Aggregation, rules []viewRule) []sdkmetric.View {
+	var views []sdkmetric.View
+	for _, rule := range rules {
+		view := rule.view()
+		views = append(views, func(i sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+			stream, ok := view(i)
+			if ok && stream.Aggregation == nil {
+				stream.Aggregation = aggregations[i.Name]
+			}
+			return stream, ok
+		})
+	}
+
+	// sorted for a deterministic order of views
+	names := make([]string, 0, len(aggregations))
+	for name := range aggregations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		matched := slices.ContainsFunc(views, func(view sdkmetric.View) bool {
+			_, ok := view(sdkmetric.Instrument{Name: name})
+			return ok
+		})
+		if !matched {
+			views = append(views, sdkmetric.NewView(sdkmetric.Instrument{Name: name}, sdkmetric.Stream{Aggregation: aggregations[name]}))
+		}
+	}
+	return views
+}
+
+// viewsFile is the format of -views-file, e.g.
+//
+//	views:
+//	- instrument: k8s.image.pull.duration
+//	  name: image_pull_duration_ms
+//	  dropAttributes: [exported.pod.image]
+//	- instrument: k8s.image.pull.wait_ratio
+//	  drop: true
+type viewsFile struct {
+	Views []viewRule `json:"views"`
+}
+
+type viewRule struct {
+	// Instrument is the name of the instruments the rule applies to, which
+	// may contain * and ? wildcards.
+	Instrument     string   `json:"instrument"`
+	Name           string   `json:"name,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	Unit           string   `json:"unit,omitempty"`
+	DropAttributes []string `json:"dropAttributes,omitempty"`
+	Drop           bool     `json:"drop,omitempty"`
+}
+
+// loadViewRules reads the view rules of a YAML or JSON -views-file. Unknown
+// fields and rules the SDK would silently ignore are rejected.
+func loadViewRules(path string) ([]viewRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file viewsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range file.Views {
+		if rule.Instrument == "" {
+			return nil, fmt.Errorf("view %d: instrument is required", i)
+		}
+		if rule.Name != "" && strings.ContainsAny(rule.Instrument, "*?") {
+			return nil, fmt.Errorf("view %d: can't rename wildcard instrument %q", i, rule.Instrument)
+		}
+	}
+	return file.Views, nil
+}
+
+// view returns the SDK view of the rule.
+func (rule viewRule) view() sdkmetric.View {
+	stream := sdkmetric.Stream{Name: rule.Name, Description: rule.Description, Unit: rule.Unit}
+	if len(rule.DropAttributes) > 0 {
+		keys := make([]attribute.Key, len(rule.DropAttributes))
+		for j, key := range rule.DropAttributes {
+			keys[j] = attribute.Key(key)
+		}
+		stream.AttributeFilter = attribute.NewDenyKeysFilter(keys...)
+	}
+	if rule.Drop {
+		stream.Aggregation = sdkmetric.AggregationDrop{}
+	}
+	return sdkmetric.NewView(sdkmetric.Instrument{Name: rule.Instrument}, stream)
+}
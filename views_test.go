@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// exportedStream describes a collected metric by name, aggregation and the
+// attribute keys of its first data point.
+type exportedStream struct {
+	name        string
+	aggregation string
+	boundaries  []float64
+	minMax      bool
+	keys        []string
+}
+
+// collectStreams records a pull duration and a wait ratio through a meter
+// provider with views and returns the exported streams, sorted by name.
+func collectStreams(t *testing.T, views []sdkmetric.View) []exportedStream {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(views...))
+	meter := provider.Meter("test")
+
+	duration, err := meter.Int64Histogram("k8s.image.pull.duration", metric.WithExplicitBucketBoundaries(15000, 30000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratio, err := meter.Float64Histogram("k8s.image.pull.wait_ratio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := metric.WithAttributes(attribute.String("exported.pod.image", "nginx"), attribute.String("exported.namespace", "default"))
+	duration.Record(context.Background(), 20000, attributes)
+	ratio.Record(context.Background(), 0.5, attributes)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	var streams []exportedStream
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			s := exportedStream{name: m.Name}
+			var set attribute.Set
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[int64]:
+				s.aggregation, s.boundaries = "explicit", data.DataPoints[0].Bounds
+				_, s.minMax = data.DataPoints[0].Min.Value()
+				set = data.DataPoints[0].Attributes
+			case metricdata.Histogram[float64]:
+				s.aggregation, s.boundaries = "explicit", data.DataPoints[0].Bounds
+				_, s.minMax = data.DataPoints[0].Min.Value()
+				set = data.DataPoints[0].Attributes
+			case metricdata.ExponentialHistogram[int64]:
+				s.aggregation = "exponential"
+				_, s.minMax = data.DataPoints[0].Min.Value()
+				set = data.DataPoints[0].Attributes
+			default:
+				t.Fatalf("unexpected data %T of %s", data, m.Name)
+			}
+			for _, kv := range set.ToSlice() {
+				s.keys = append(s.keys, string(kv.Key))
+			}
+			streams = append(streams, s)
+		}
+	}
+	slices.SortFunc(streams, func(a, b exportedStream) int {
+		if a.name < b.name {
+			return -1
+		}
+		if a.name > b.name {
+			return 1
+		}
+		return 0
+	})
+	return streams
+}
+
+func writeViewsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "views.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestViews(t *testing.T) {
+	allKeys := []string{"exported.namespace", "exported.pod.image"}
+	ratio := exportedStream{name: "k8s.image.pull.wait_ratio", aggregation: "explicit", boundaries: []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}, minMax: true, keys: allKeys}
+
+	tests := []struct {
+		name          string
+		histogramType string
+		minMax        bool
+		viewsFile     string
+		want          []exportedStream
+	}{
+		{
+			name:          "defaults keep the instrument's boundaries",
+			histogramType: "explicit",
+			minMax:        true,
+			want: []exportedStream{
+				{name: "k8s.image.pull.duration", aggregation: "explicit", boundaries: []float64{15000, 30000}, minMax: true, keys: allKeys},
+				ratio,
+			},
+		},
+		{
+			name:          "rename keeps the instrument's boundaries",
+			histogramType: "explicit",
+			minMax:        true,
+			viewsFile:     "views:\n- instrument: k8s.image.pull.duration\n  name: image_pull_duration_ms\n",
+			want: []exportedStream{
+				{name: "image_pull_duration_ms", aggregation: "explicit", boundaries: []float64{15000, 30000}, minMax: true, keys: allKeys},
+				ratio,
+			},
+		},
+		{
+			name:          "exponential",
+			histogramType: "exponential",
+			minMax:        true,
+			want: []exportedStream{
+				{name: "k8s.image.pull.duration", aggregation: "exponential", minMax: true, keys: allKeys},
+				ratio,
+			},
+		},
+		{
+			name:          "drop with exponential",
+			histogramType: "exponential",
+			minMax:        true,
+			viewsFile:     "views:\n- instrument: k8s.image.pull.duration\n  drop: true\n",
+			want:          []exportedStream{ratio},
+		},
+		{
+			name:          "drop without min and max",
+			histogramType: "explicit",
+			minMax:        false,
+			viewsFile:     "views:\n- instrument: k8s.image.pull.duration\n  drop: true\n",
+			want:          []exportedStream{ratio},
+		},
+		{
+			name:          "rename with exponential is exported once",
+			histogramType: "exponential",
+			minMax:        false,
+			viewsFile:     "views:\n- instrument: k8s.image.pull.duration\n  name: image_pull_duration_ms\n",
+			want: []exportedStream{
+				{name: "image_pull_duration_ms", aggregation: "exponential", keys: allKeys},
+				ratio,
+			},
+		},
+		{
+			name:          "rename without min and max uses the configured buckets",
+			histogramType: "explicit",
+			minMax:        false,
+			viewsFile:     "views:\n- instrument: k8s.image.pull.duration\n  name: image_pull_duration_ms\n",
+			want: []exportedStream{
+				{name: "image_pull_duration_ms", aggregation: "explicit", boundaries: []float64{1000, 2000}, keys: allKeys},
+				ratio,
+			},
+		},
+		{
+			name:          "wildcard dropping attributes keeps the aggregation",
+			histogramType: "exponential",
+			minMax:        true,
+			viewsFile:     "views:\n- instrument: k8s.image.*\n  dropAttributes: [exported.pod.image]\n",
+			want: []exportedStream{
+				{name: "k8s.image.pull.duration", aggregation: "exponential", minMax: true, keys: []string{"exported.namespace"}},
+				{name: "k8s.image.pull.wait_ratio", aggregation: "explicit", boundaries: ratio.boundaries, minMax: true, keys: []string{"exported.namespace"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			histograms, err := histogramAggregations(tt.histogramType, tt.minMax, []float64{1000, 2000}, []float64{100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rules []viewRule
+			if tt.viewsFile != "" {
+				rules, err = loadViewRules(writeViewsFile(t, tt.viewsFile))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := collectStreams(t, newViews(histograms, rules))
+			if len(got) != len(tt.want) {
+				t.Fatalf("exported %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.name != w.name || g.aggregation != w.aggregation || !slices.Equal(g.boundaries, w.boundaries) || g.minMax != w.minMax || !slices.Equal(g.keys, w.keys) {
+					t.Errorf("stream %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadViewRulesRejectsInvalidRules(t *testing.T) {
+	for _, content := range []string{
+		"views:\n- name: foo\n",
+		"views:\n- instrument: k8s.image.*\n  name: foo\n",
+		"views:\n- instrument: k8s.image.pull.duration\n  unknown: true\n",
+	} {
+		if _, err := loadViewRules(writeViewsFile(t, content)); err == nil {
+			t.Errorf("loadViewRules(%q) succeeded, want an error", content)
+		}
+	}
+}
+
+func TestHistogramMinMax(t *testing.T) {
+	tests := []struct {
+		histogramType string
+		minMax        bool
+	}{
+		{"explicit", true},
+		{"explicit", false},
+		{"exponential", true},
+		{"exponential", false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s min max %v", tt.histogramType, tt.minMax), func(t *testing.T) {
+			histograms, err := histogramAggregations(tt.histogramType, tt.minMax, []float64{1000, 2000}, []float64{100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := sdkmetric.NewManualReader()
+			meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(newViews(histograms, nil)...)).Meter("test")
+			for _, name := range durationInstruments {
+				h, err := meter.Int64Histogram(name, metric.WithExplicitBucketBoundaries(15000, 30000))
+				if err != nil {
+					t.Fatal(err)
+				}
+				h.Record(context.Background(), 1500)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(context.Background(), &rm); err != nil {
+				t.Fatal(err)
+			}
+			var seen int
+			for _, m := range rm.ScopeMetrics[0].Metrics {
+				var minimum, maximum bool
+				switch data := m.Data.(type) {
+				case metricdata.Histogram[int64]:
+					_, minimum = data.DataPoints[0].Min.Value()
+					_, maximum = data.DataPoints[0].Max.Value()
+				case metricdata.ExponentialHistogram[int64]:
+					_, minimum = data.DataPoints[0].Min.Value()
+					_, maximum = data.DataPoints[0].Max.Value()
+				default:
+					t.Fatalf("unexpected data %T of %s", data, m.Name)
+				}
+				if minimum != tt.minMax || maximum != tt.minMax {
+					t.Errorf("%s has min %v and max %v, want %v", m.Name, minimum, maximum, tt.minMax)
+				}
+				seen++
+			}
+			if seen != len(durationInstruments) {
+				t.Errorf("exported %d histograms, want %d", seen, len(durationInstruments))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchEvents starts the informers of factory, feeding events watched
+// through eventsAPI ("core" or "events") into handler, along with the caches
+// it registered for lookups. It returns once the caches have synced, or with
+// an error if they didn't within syncTimeout (0 waits indefinitely); the
+// informers run until stopCh is closed. The events informer's state is
+// reported on meter, labelled with clusterName if not empty.
+func watchEvents(ctx context.Context, meter metric.Meter, factory informers.SharedInformerFactory, handler *pullmetrics.Handler, eventsAPI, clusterName string, syncTimeout time.Duration, stopCh <-chan struct{}) error {
+	var informer cache.SharedIndexInformer
+	switch eventsAPI {
+	case "core":
+		informer = factory.Core().V1().Events().Informer()
+	case "events":
+		informer = factory.Events().V1().Events().Informer()
+	default:
+		return fmt.Errorf("unknown events API %q, expected core or events", eventsAPI)
+	}
+
+	var attributes []attribute.KeyValue
+	if clusterName != "" {
+		attributes = append(attributes, attribute.String("k8s.cluster.name", clusterName))
+	}
+	synced := &informerSync{}
+	if err := registerInformerGauges(meter, informer, synced, metric.WithAttributes(attributes...)); err != nil {
+		return err
+	}
+
+	health := watchHealth.cluster(clusterName)
+	if err := informer.SetWatchErrorHandler(health.handleWatchError); err != nil {
+		return fmt.Errorf("setting watch error handler: %w", err)
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			event, ok := toCoreEvent(obj)
+			if !ok {
+				return
+			}
+			health.eventReceived()
+			synced.mark()
+			handler.OnEvent(ctx, event)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldEvent, ok := toCoreEvent(oldObj)
+			if !ok {
+				return
+			}
+			newEvent, ok := toCoreEvent(newObj)
+			if !ok {
+				return
+			}
+			health.eventReceived()
+			synced.mark()
+			handler.OnUpdate(ctx, oldEvent, newEvent)
+		},
+	})
+
+	factory.Start(stopCh)
+
+	// an unreachable API server would otherwise block startup forever
+	syncCtx, cancel := context.WithCancel(ctx)
+	if syncTimeout > 0 {
+		syncCtx, cancel = context.WithTimeout(ctx, syncTimeout)
+	}
+	defer cancel()
+	for typ, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+		if !synced {
+			if errors.Is(syncCtx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("cache for %v didn't sync within %v, check that the API server is reachable", typ, syncTimeout)
+			}
+			return fmt.Errorf("syncing cache for %v", typ)
+		}
+	}
+	synced.mark()
+	return nil
+}
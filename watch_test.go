@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s-image-pull-metrics/pullmetrics"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pulledEvents returns n kubelet Pulled events of distinct pods.
+func pulledEvents(n int) []runtime.Object {
+	var events []runtime.Object
+	for i := range n {
+		now := metav1.Now()
+		events = append(events, &v1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("web-%d.pulled", i), Namespace: metav1.NamespaceDefault},
+			InvolvedObject: v1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: metav1.NamespaceDefault,
+				Name:      fmt.Sprintf("web-%d", i),
+				FieldPath: "spec.containers{web}",
+			},
+			Reason:         "Pulled",
+			Message:        `Successfully pulled image "nginx:1.27" in 1s (1s including waiting). Image size: 1000 bytes.`,
+			Source:         v1.EventSource{Component: "kubelet", Host: "node-1"},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		})
+	}
+	return events
+}
+
+func TestWatchEventsPerCluster(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	clusters := map[string]int{"prod": 3, "staging": 1}
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	for name, pulls := range clusters {
+		client := fake.NewClientset(pulledEvents(pulls)...)
+		factory := informers.NewSharedInformerFactory(client, 0)
+		handler, err := pullmetrics.New(meter,
+			pullmetrics.WithLookups(client, factory, 1000, 1000),
+			pullmetrics.WithClusterName(name),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := watchEvents(context.Background(), meter, factory, handler, "core", name, 5*time.Second, stopCh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the informers deliver the listed events after their caches synced
+	want := map[string]int64{"prod": 3, "staging": 1}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := make(map[string]int64)
+		for _, p := range int64Points(t, reader, "k8s.image.pulls") {
+			cluster, _ := p.Attributes.Value("k8s.cluster.name")
+			got[cluster.AsString()] += p.Value
+		}
+		if maps.Equal(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("k8s.image.pulls per cluster = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cacheSizes := make(map[string]int64)
+	for _, p := range int64Points(t, reader, "k8s.image.pull.informer.cache_size") {
+		cluster, _ := p.Attributes.Value("k8s.cluster.name")
+		cacheSizes[cluster.AsString()] = p.Value
+	}
+	if !maps.Equal(cacheSizes, want) {
+		t.Errorf("k8s.image.pull.informer.cache_size per cluster = %v, want %v", cacheSizes, want)
+	}
+}
+
+func TestWatchEventsSyncTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		syncTimeout time.Duration
+		wantErr     bool
+	}{
+		{name: "synced", syncTimeout: 5 * time.Second},
+		{name: "never syncs", syncTimeout: 100 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+			if tt.wantErr {
+				// an unreachable API server fails every list
+				client.PrependReactor("list", "events", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+			}
+			factory := informers.NewSharedInformerFactory(client, 0)
+			meter := sdkmetric.NewMeterProvider().Meter("test")
+			handler, err := pullmetrics.New(meter, pullmetrics.WithLookups(client, factory, 1000, 1000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+
+			start := time.Now()
+			err = watchEvents(context.Background(), meter, factory, handler, "core", "", tt.syncTimeout, stopCh)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("watchEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "didn't sync within 100ms") {
+				t.Errorf("watchEvents() error = %v, want a sync timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("watchEvents() returned after %s, want it bounded by -sync-timeout", elapsed)
+			}
+		})
+	}
+}